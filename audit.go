@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// auditor looks for weak passwords in the exported entries. Passwords are
+// only kept as hashes and never reported, findings name the entries.
+type auditor struct {
+	minLength int
+	common    map[[sha256.Size]byte]bool
+
+	mu     sync.Mutex
+	users  map[[sha256.Size]byte][]string
+	short  []string
+	listed []string
+}
+
+// auditFindings is the outcome of an audit as written to the report.
+type auditFindings struct {
+	Short  []string   `json:"short"`
+	Common []string   `json:"common"`
+	Reused [][]string `json:"reused"`
+}
+
+// newAuditor returns an auditor flagging passwords shorter than minLength
+// or listed in the file commonList, one password per line.
+func newAuditor(minLength int, commonList string) (*auditor, error) {
+	a := &auditor{minLength: minLength, common: map[[sha256.Size]byte]bool{}, users: map[[sha256.Size]byte][]string{}}
+	if commonList == "" {
+		return a, nil
+	}
+	f, err := os.Open(commonList)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimRight(scanner.Text(), "\r"); line != "" {
+			a.common[sha256.Sum256([]byte(line))] = true
+		}
+	}
+	return a, scanner.Err()
+}
+
+// observe passes entries through while auditing their passwords.
+func (a *auditor) observe(entries <-chan *entry) <-chan *entry {
+	c := make(chan *entry)
+	go func() {
+		defer close(c)
+		for e := range entries {
+			if e.LoginPassword != "" {
+				a.check(e)
+			}
+			c <- e
+		}
+	}()
+	return c
+}
+
+func (a *auditor) check(e *entry) {
+	name := e.Name
+	if folder := folderName(e); folder != "" {
+		name = folder + "/" + name
+	}
+	sum := sha256.Sum256([]byte(e.LoginPassword))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users[sum] = append(a.users[sum], name)
+	if len([]rune(e.LoginPassword)) < a.minLength {
+		a.short = append(a.short, name)
+	}
+	if a.common[sum] {
+		a.listed = append(a.listed, name)
+	}
+}
+
+func (a *auditor) findings() auditFindings {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f := auditFindings{
+		Short:  append([]string{}, a.short...),
+		Common: append([]string{}, a.listed...),
+		Reused: [][]string{},
+	}
+	for _, names := range a.users {
+		if len(names) > 1 {
+			f.Reused = append(f.Reused, append([]string(nil), names...))
+		}
+	}
+	sort.Slice(f.Reused, func(i, j int) bool { return f.Reused[i][0] < f.Reused[j][0] })
+	return f
+}
+
+// print writes the findings in a readable form to w.
+func (f auditFindings) print(w io.Writer, minLength int) {
+	for _, name := range f.Short {
+		fmt.Fprintf(w, "Audit: password of %s is shorter than %d characters\n", name, minLength)
+	}
+	for _, name := range f.Common {
+		fmt.Fprintf(w, "Audit: password of %s is a common password\n", name)
+	}
+	for _, names := range f.Reused {
+		fmt.Fprintf(w, "Audit: %s share the same password\n", strings.Join(names, ", "))
+	}
+	fmt.Fprintf(w, "Audit: %d short, %d common and %d reused passwords\n", len(f.Short), len(f.Common), len(f.Reused))
+}
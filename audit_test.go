@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	common := filepath.Join(t.TempDir(), "common.txt")
+	if err := os.WriteFile(common, []byte("letmein123456\r\n\nqwertzuiop\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAuditor(10, common)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := []*entry{
+		{Folder: "web", Name: "shop", LoginPassword: "hunter2"},
+		{Folder: "web", Name: "forum", LoginPassword: "correct horse battery"},
+		{Folder: "/", Name: "mail", LoginPassword: "correct horse battery"},
+		{Folder: "work", Name: "vpn", LoginPassword: "letmein123456"},
+		{Folder: "work", Name: "wiki", LoginPassword: "hunter2"},
+		{Folder: "work", Name: "ümläüt", LoginPassword: "äöüäöüäöüä"},
+		{Folder: "/", Name: "note"},
+	}
+	if got := collect(a.observe(entryChan(entries...))); len(got) != len(entries) {
+		t.Fatalf("got %d entries passed on, want %d", len(got), len(entries))
+	}
+
+	want := auditFindings{
+		Short:  []string{"web/shop", "work/wiki"},
+		Common: []string{"work/vpn"},
+		Reused: [][]string{{"web/forum", "mail"}, {"web/shop", "work/wiki"}},
+	}
+	got := a.findings()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	var printed bytes.Buffer
+	got.print(&printed, 10)
+	report, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e.LoginPassword == "" {
+			continue
+		}
+		if strings.Contains(printed.String(), e.LoginPassword) || strings.Contains(string(report), e.LoginPassword) {
+			t.Errorf("the password of %s is in the audit output", e.Name)
+		}
+	}
+	if !strings.HasSuffix(printed.String(), "Audit: 2 short, 1 common and 2 reused passwords\n") {
+		t.Errorf("got %q, want it to end with the counts", printed.String())
+	}
+}
+
+func TestAuditKeepsTheExport(t *testing.T) {
+	files := map[string]string{"shop": "hunter2\n", "wiki": "hunter2\nlogin: me\n", "mail": "a long enough password\n"}
+	want, err := exportStore(t, files, "--sort", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := exportStore(t, files, "--sort", "name", "--audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got\n%s\nwith --audit, want\n%s", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+var charsets = map[string]*charmap.Charmap{
+	"windows-1252": charmap.Windows1252,
+	"latin1":       charmap.ISO8859_1,
+}
+
+// charsetWriter transcodes the UTF-8 written to it to a single byte
+// charset. Runes the charset cannot represent are written as ?.
+type charsetWriter struct {
+	out io.Writer
+	cm  *charmap.Charmap
+	// pending holds the start of a rune split across writes.
+	pending     []byte
+	unsupported int
+}
+
+func (w *charsetWriter) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	buf := make([]byte, 0, len(data))
+	for len(data) > 0 && utf8.FullRune(data) {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		b, ok := w.cm.EncodeRune(r)
+		if !ok || r == utf8.RuneError && size == 1 {
+			w.unsupported++
+			b = '?'
+		}
+		buf = append(buf, b)
+	}
+	w.pending = append([]byte(nil), data...)
+	if _, err := w.out.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close writes a rune left incomplete at the end of the output as ?.
+func (w *charsetWriter) Close() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	w.unsupported++
+	w.pending = nil
+	_, err := w.out.Write([]byte{'?'})
+	return err
+}
+
+// withCharset returns f writing its output in the charset cm. unsupported
+// is increased by the number of characters that had to be replaced.
+func withCharset(f format, cm *charmap.Charmap, unsupported *int) format {
+	write := f.write
+	f.write = func(out io.Writer, entries <-chan *entry) error {
+		w := &charsetWriter{out: out, cm: cm}
+		err := write(w, entries)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		*unsupported += w.unsupported
+		return err
+	}
+	return f
+}
+
+// withBOM returns f starting its output with a UTF-8 byte order mark, which
+// Excel needs to detect UTF-8 CSV files.
+func withBOM(f format) format {
+	write := f.write
+	f.write = func(out io.Writer, entries <-chan *entry) error {
+		if _, err := io.WriteString(out, "\uFEFF"); err != nil {
+			return err
+		}
+		return write(out, entries)
+	}
+	return f
+}
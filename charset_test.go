@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCharsetWriter(t *testing.T) {
+	tests := []struct {
+		name            string
+		charset         string
+		writes          []string
+		want            string
+		wantUnsupported int
+	}{
+		{"ascii", "windows-1252", []string{"name,password\n"}, "name,password\n", 0},
+		{"accents", "windows-1252", []string{"Müller,café,naïve"}, "M\xfcller,caf\xe9,na\xefve", 0},
+		{"euro", "windows-1252", []string{"5 €"}, "5 \x80", 0},
+		{"latin1 has no euro", "latin1", []string{"5 €, ä"}, "5 ?, \xe4", 1},
+		{"not representable", "windows-1252", []string{"日本"}, "??", 2},
+		{"rune split across writes", "windows-1252", []string{"M\xc3", "\xbcller"}, "M\xfcller", 0},
+		{"incomplete rune at the end", "windows-1252", []string{"ab\xc3"}, "ab?", 1},
+		{"invalid UTF-8", "windows-1252", []string{"a\xffb"}, "a?b", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := &charsetWriter{out: &out, cm: charsets[tt.charset]}
+			for _, s := range tt.writes {
+				if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+					t.Fatalf("writing %q: got %d, %v", s, n, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want || w.unsupported != tt.wantUnsupported {
+				t.Errorf("got %q with %d unsupported, want %q with %d", got, w.unsupported, tt.want, tt.wantUnsupported)
+			}
+		})
+	}
+}
+
+func TestOutputCharset(t *testing.T) {
+	out, err := exportStore(t, map[string]string{"Müller": "pw\nlogin: rené\n"}, "--output-charset", "windows-1252")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, ",M\xfcller,") || !strings.Contains(out, ",ren\xe9,") {
+		t.Errorf("got %q, want the name and username in Windows-1252", out)
+	}
+}
+
+func TestCSVBOM(t *testing.T) {
+	const bom = "\xef\xbb\xbf"
+	files := map[string]string{"Müller": "pw\n", "other": "pw\n"}
+	tests := []struct {
+		name   string
+		args   []string
+		bom    bool
+		header string
+	}{
+		{"default", nil, false, "folder,"},
+		{"bom", []string{"--csv-bom"}, true, "folder,"},
+		{"other csv format", []string{"--csv-bom", "--format", "nordpass"}, true, "name,"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, files, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.HasPrefix(out, bom); got != tt.bom {
+				t.Errorf("got a BOM: %v, want %v in %q", got, tt.bom, out)
+			}
+			if n := strings.Count(out, bom); tt.bom && n != 1 {
+				t.Errorf("got %d BOMs, want 1", n)
+			}
+			if !strings.HasPrefix(strings.TrimPrefix(out, bom), tt.header) {
+				t.Errorf("header does not follow the BOM in %q", out)
+			}
+		})
+	}
+}
+
+func TestCSVBOMNeedsCSV(t *testing.T) {
+	for _, args := range [][]string{
+		{"--csv-bom", "--format", "enpass"},
+		{"--csv-bom", "--output-charset", "latin1"},
+	} {
+		if _, err := exportStore(t, map[string]string{"a": "pw\n"}, args...); !errors.Is(err, errUsage) {
+			t.Errorf("%q: got %v, want %v", args, err, errUsage)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/atotto/clipboard"
+)
+
+// writeClipboard puts text on the system clipboard, a variable so tests can
+// replace it.
+var writeClipboard = clipboard.WriteAll
+
+// exportToClipboard runs export into memory and puts the result on the
+// system clipboard, also when some entries were skipped.
+func exportToClipboard(argv *argT, list io.Reader) error {
+	warnf("Warning: --clipboard puts all exported secrets in plain text on the clipboard, clear it once the import is done\n")
+	var buf bytes.Buffer
+	err := export(argv, &buf, list)
+	if err != nil && !errors.Is(err, errPartial) {
+		return err
+	}
+	if cerr := writeClipboard(buf.String()); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClipboard(t *testing.T) {
+	fakeGPG(t, catGPG)
+	tests := []struct {
+		name    string
+		files   map[string]string
+		clipErr error
+		wantErr error
+	}{
+		{"export", map[string]string{"site": "hunter2\n"}, nil, nil},
+		{"partial", map[string]string{"site": "hunter2\n", "bin": "\xff\xfe\n"}, nil, errPartial},
+		{"clipboard fails", map[string]string{"site": "hunter2\n"}, errors.New("no clipboard"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(old func(string) error) { writeClipboard = old }(writeClipboard)
+			var got string
+			writeClipboard = func(text string) error {
+				got = text
+				return tt.clipErr
+			}
+			err := runArgs("--no-unlock", "--clipboard", "--password-store", writeStore(t, tt.files))
+			if !strings.Contains(got, ",hunter2,") {
+				t.Errorf("got clipboard %q, want the export", got)
+			}
+			switch {
+			case tt.clipErr != nil:
+				if !errors.Is(err, tt.clipErr) {
+					t.Errorf("got %v, want %v", err, tt.clipErr)
+				}
+			case !errors.Is(err, tt.wantErr):
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// cloneCommand returns the git command cloning url into dir. The -- keeps
+// a url starting with a dash from being read as an option.
+func cloneCommand(url, dir string) *exec.Cmd {
+	return exec.Command("git", "clone", "--quiet", "--", url, dir)
+}
+
+// cloneStore clones the password store at url into a new temporary
+// directory and returns the path of the clone.
+func cloneStore(url string) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", fmt.Errorf("--store-url needs git: %w", err)
+	}
+	tmp, err := os.MkdirTemp("", "pass2bitwarden-")
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(tmp, "store")
+	cmd := cloneCommand(url, dir)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.RemoveAll(tmp)
+		return "", fmt.Errorf("could not clone %s: %w", url, err)
+	}
+	return dir, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCloneCommand(t *testing.T) {
+	tests := []struct {
+		name, url string
+		want      []string
+	}{
+		{"ssh", "git@example.com:alice/pass.git", []string{"git", "clone", "--quiet", "--", "git@example.com:alice/pass.git", "/tmp/store"}},
+		{"https", "https://example.com/pass.git", []string{"git", "clone", "--quiet", "--", "https://example.com/pass.git", "/tmp/store"}},
+		{"option-like url", "--upload-pack=touch x", []string{"git", "clone", "--quiet", "--", "--upload-pack=touch x", "/tmp/store"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cloneCommand(tt.url, "/tmp/store").Args; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Ways --collapse-single-folders moves the entry out of its folder.
+const (
+	collapsePrefix = "prefix" // the folder name is put in front of the entry name
+	collapseDrop   = "drop"   // the folder name is dropped
+)
+
+// collapseSingleFolders collects all entries and moves the only entry of a
+// folder without subfolders into the parent folder. mode is collapsePrefix
+// or collapseDrop.
+func collapseSingleFolders(entries <-chan *entry, mode string) <-chan *entry {
+	c := make(chan *entry)
+	go func() {
+		defer close(c)
+		var all []*entry
+		count := map[string]int{}
+		parents := map[string]bool{}
+		for e := range entries {
+			all = append(all, e)
+			folder := folderName(e)
+			count[folder]++
+			for i := strings.LastIndex(folder, "/"); i > 0; i = strings.LastIndex(folder[:i], "/") {
+				parents[folder[:i]] = true
+			}
+		}
+		for _, e := range all {
+			folder := folderName(e)
+			if folder != "" && count[folder] == 1 && !parents[folder] {
+				parent, name := "/", folder
+				if i := strings.LastIndex(folder, "/"); i >= 0 {
+					parent, name = folder[:i], folder[i+1:]
+				}
+				e.Folder = parent
+				if mode == collapsePrefix {
+					e.Name = name + "/" + e.Name
+				}
+				fmt.Fprintf(os.Stderr, "Folder %s only holds %s, moved to %s\n", folder, e.Name, parent)
+			}
+			c <- e
+		}
+	}()
+	return c
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCollapseSingleFolders(t *testing.T) {
+	entries := func() []*entry {
+		return []*entry{
+			{Folder: "/", Name: "mail"},
+			{Folder: "web", Name: "github"},
+			{Folder: "web", Name: "gitlab"},
+			{Folder: "bank", Name: "ing"},
+			{Folder: "work/vpn", Name: "office"},
+			{Folder: "work/ci", Name: "jenkins"},
+			{Folder: "work/ci", Name: "gitlab"},
+			// its folder holds a folder, so it stays
+			{Folder: "games", Name: "steam"},
+			{Folder: "games/old", Name: "origin"},
+			{Folder: "games/old", Name: "uplay"},
+		}
+	}
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{collapsePrefix, []string{
+			"/|bank/ing", "/|mail", "games/old|origin", "games/old|uplay", "games|steam",
+			"web|github", "web|gitlab", "work/ci|gitlab", "work/ci|jenkins", "work|vpn/office",
+		}},
+		{collapseDrop, []string{
+			"/|ing", "/|mail", "games/old|origin", "games/old|uplay", "games|steam",
+			"web|github", "web|gitlab", "work/ci|gitlab", "work/ci|jenkins", "work|office",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			var got []string
+			for _, e := range collect(collapseSingleFolders(entryChan(entries()...), tt.mode)) {
+				got = append(got, e.Folder+"|"+e.Name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
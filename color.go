@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiReset  = "\x1b[0m"
+)
+
+// stderrColor is set by run when warnings and errors on stderr are
+// colored. The export itself is never colored.
+var stderrColor bool
+
+// useColor reports whether stderr gets colors: it has to be a terminal,
+// and neither noColor nor NO_COLOR may be set.
+func useColor(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isatty.IsTerminal(os.Stderr.Fd()) || isatty.IsCygwinTerminal(os.Stderr.Fd())
+}
+
+// paint returns s in color if stderrColor is set, keeping a trailing
+// newline outside of the color codes.
+func paint(color, s string) string {
+	if !stderrColor {
+		return s
+	}
+	trimmed := strings.TrimSuffix(s, "\n")
+	return color + trimmed + ansiReset + s[len(trimmed):]
+}
+
+// warnf prints a warning about the export to stderr, in yellow.
+func warnf(format string, args ...interface{}) {
+	fmt.Fprint(os.Stderr, paint(ansiYellow, fmt.Sprintf(format, args...)))
+}
+
+// errorf prints an error that does not end the export to stderr, in red.
+func errorf(format string, args ...interface{}) {
+	fmt.Fprint(os.Stderr, paint(ansiRed, fmt.Sprintf(format, args...)))
+}
+
+// coloredError prints as its error in red, for the error run ends with.
+type coloredError struct{ error }
+
+func (e coloredError) Error() string { return paint(ansiRed, e.error.Error()) }
+
+func (e coloredError) Unwrap() error { return e.error }
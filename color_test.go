@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// capture points file, os.Stdout or os.Stderr, at a pipe while fn runs
+// and returns what was written to it.
+func capture(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = w
+	defer func() { *file = saved }()
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestUseColorNotATerminal(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		noColor bool
+		env     string
+	}{
+		{"plain", false, ""},
+		{"--no-color", true, ""},
+		{"NO_COLOR", false, "1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.env)
+			var got bool
+			capture(t, &os.Stderr, func() { got = useColor(tt.noColor) })
+			if got {
+				t.Error("got colors on a pipe")
+			}
+		})
+	}
+}
+
+func TestPaint(t *testing.T) {
+	defer func(c bool) { stderrColor = c }(stderrColor)
+	tests := []struct {
+		color bool
+		want  string
+	}{
+		{false, "Skipping a\n"},
+		{true, ansiYellow + "Skipping a" + ansiReset + "\n"},
+	}
+	for _, tt := range tests {
+		stderrColor = tt.color
+		if got := capture(t, &os.Stderr, func() { warnf("Skipping %s\n", "a") }); got != tt.want {
+			t.Errorf("colors %v: got %q, want %q", tt.color, got, tt.want)
+		}
+	}
+	stderrColor = true
+	err := coloredError{errUsage}
+	if !errors.Is(err, errUsage) || err.Error() != ansiRed+errUsage.Error()+ansiReset {
+		t.Errorf("got %q, want the wrapped error in red", err.Error())
+	}
+}
+
+func TestExportIsNeverColored(t *testing.T) {
+	var out string
+	stderr := capture(t, &os.Stderr, func() {
+		out, _ = exportStore(t, map[string]string{"text": "pw\n", "image": "\x89PNG\r\n\x1a\n\xff\xd8"})
+	})
+	if strings.Contains(out, "\x1b[") || strings.Contains(stderr, "\x1b[") {
+		t.Errorf("got colors in the export %q or on stderr %q", out, stderr)
+	}
+	if !strings.Contains(stderr, "image") {
+		t.Errorf("got stderr %q, want a warning about image", stderr)
+	}
+}
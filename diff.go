@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// csvRecord returns the exported columns of e keyed by their header name.
+func csvRecord(e *entry) map[string]string {
+	fields, _ := e.Fields.MarshalCSV()
+	return map[string]string{
+		"folder":         e.Folder,
+		"favorite":       strconv.Itoa(e.Favorite),
+		"type":           e.Type,
+		"name":           e.Name,
+		"notes":          e.Notes,
+		"fields":         fields,
+		"login_uri":      e.LoginURI,
+		"login_username": e.LoginUsername,
+		"login_password": e.LoginPassword,
+		"login_totp":     e.LoginTOTP,
+	}
+}
+
+// entryKey identifies an entry across exports.
+func entryKey(folder, name string) string {
+	return folder + "\x00" + name
+}
+
+// readExport reads a previously written export, keyed by entryKey.
+func readExport(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read header of %s: %v", path, err)
+	}
+	if len(header) > 0 {
+		// exports written with --csv-bom
+		header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	}
+	records := make(map[string]map[string]string)
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %v", path, err)
+		}
+		record := make(map[string]string, len(header))
+		for i, column := range header {
+			record[column] = row[i]
+		}
+		records[entryKey(record["folder"], record["name"])] = record
+	}
+	return records, nil
+}
+
+// diffEntries passes on the entries that are new or changed compared to
+// previous, an export read by readExport. Once entries is drained a report of
+// the added, changed and removed entries is written to report.
+func diffEntries(previous map[string]map[string]string, entries <-chan *entry, report io.Writer) <-chan *entry {
+	c := make(chan *entry)
+	go func() {
+		defer close(c)
+		seen := make(map[string]bool)
+		var added, changed int
+		for e := range entries {
+			key := entryKey(e.Folder, e.Name)
+			seen[key] = true
+			old, ok := previous[key]
+			if ok && !recordChanged(old, csvRecord(e)) {
+				continue
+			}
+			if ok {
+				changed++
+			} else {
+				added++
+			}
+			c <- e
+		}
+
+		removed := 0
+		for key, record := range previous {
+			if !seen[key] {
+				removed++
+				fmt.Fprintf(report, "Removed since previous export: %s/%s\n", record["folder"], record["name"])
+			}
+		}
+		fmt.Fprintf(report, "Compared to previous export: %d added, %d changed, %d removed\n", added, changed, removed)
+	}()
+	return c
+}
+
+// recordChanged compares the columns the previous export contains.
+func recordChanged(old, current map[string]string) bool {
+	for column, value := range old {
+		if v, ok := current[column]; ok && v != value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// entryChan returns a closed channel holding entries.
+func entryChan(entries ...*entry) <-chan *entry {
+	c := make(chan *entry, len(entries))
+	for _, e := range entries {
+		c <- e
+	}
+	close(c)
+	return c
+}
+
+// collect drains entries.
+func collect(entries <-chan *entry) []*entry {
+	var all []*entry
+	for e := range entries {
+		all = append(all, e)
+	}
+	return all
+}
+
+func TestDiffEntries(t *testing.T) {
+	var old bytes.Buffer
+	previous := []*entry{
+		{Folder: "web", Name: "same", Type: "login", LoginPassword: "pw"},
+		{Folder: "web", Name: "changed", Type: "login", LoginPassword: "old"},
+		{Folder: "web", Name: "removed", Type: "login", LoginPassword: "pw"},
+	}
+	if err := writeCSV(&old, entryChan(previous...)); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "previous.csv")
+	if err := os.WriteFile(path, old.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	records, err := readExport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var report bytes.Buffer
+	got := collect(diffEntries(records, entryChan(
+		&entry{Folder: "web", Name: "same", Type: "login", LoginPassword: "pw"},
+		&entry{Folder: "web", Name: "changed", Type: "login", LoginPassword: "new"},
+		&entry{Folder: "web", Name: "added", Type: "login", LoginPassword: "pw"},
+	), &report))
+
+	var names []string
+	for _, e := range got {
+		names = append(names, e.Name)
+	}
+	if want := "changed,added"; strings.Join(names, ",") != want {
+		t.Errorf("got %v, want %s", names, want)
+	}
+	if !strings.Contains(report.String(), "Removed since previous export: web/removed") {
+		t.Errorf("removed entry missing from report:\n%s", report.String())
+	}
+	if !strings.Contains(report.String(), "1 added, 1 changed, 1 removed") {
+		t.Errorf("wrong counts in report:\n%s", report.String())
+	}
+}
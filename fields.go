@@ -0,0 +1,463 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+type field struct {
+	key   string
+	value string
+}
+
+// fieldList holds the custom fields of an entry in the order they appear in
+// the password file. Keys are unique once buildEntry has returned.
+type fieldList []field
+
+func (f *fieldList) MarshalCSV() (string, error) {
+	var builder strings.Builder
+	for _, fl := range *f {
+		builder.WriteString(fmt.Sprintf("%s: %s\n", fl.key, fl.value))
+	}
+	return builder.String(), nil
+}
+
+func (f fieldList) lookup(key string) (string, bool) {
+	for _, fl := range f {
+		if fl.key == key {
+			return fl.value, true
+		}
+	}
+	return "", false
+}
+
+func (f fieldList) has(key string) bool {
+	_, ok := f.lookup(key)
+	return ok
+}
+
+// pop removes the first field named key and returns its value.
+func (f *fieldList) pop(key string) string {
+	for i, fl := range *f {
+		if fl.key == key {
+			*f = append((*f)[:i], (*f)[i+1:]...)
+			return fl.value
+		}
+	}
+	return ""
+}
+
+// popAll removes every field named key and returns their values in order.
+func (f *fieldList) popAll(key string) []string {
+	var values []string
+	kept := (*f)[:0]
+	for _, fl := range *f {
+		if fl.key == key {
+			values = append(values, fl.value)
+		} else {
+			kept = append(kept, fl)
+		}
+	}
+	*f = kept
+	return values
+}
+
+// freeKey returns key, or the first key_N not yet present in f.
+func (f fieldList) freeKey(key string) string {
+	name := key
+	for i := 2; f.has(name); i++ {
+		name = fmt.Sprintf("%s_%d", key, i)
+	}
+	return name
+}
+
+// dedupe renames repeated keys to key_N so that no value is lost.
+func (f fieldList) dedupe(fname string) {
+	for i := range f {
+		if !f[:i].has(f[i].key) {
+			continue
+		}
+		name := f.freeKey(f[i].key)
+		warnf("Duplicate field %s in password %s stored as %s\n", f[i].key, fname, name)
+		f[i].key = name
+	}
+}
+
+func containsFold(list []string, key string) bool {
+	for _, k := range list {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFields reads the YAML key/value pairs of content, keeping their order
+// and any repeated keys. As YAML includes JSON, this also reads JSON
+// objects. Nested values are flattened, see flattenField.
+func parseFields(content string) (fieldList, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, errors.New("content is not a list of key: value pairs")
+	}
+
+	var fields fieldList
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		flattenField(&fields, root.Content[i].Value, root.Content[i+1])
+	}
+	return fields, nil
+}
+
+// flattenField adds v as the field key. Nested mappings become fields with
+// dotted keys, lists of plain values one value per line and JSON objects
+// and lists are kept as JSON text.
+func flattenField(fields *fieldList, key string, v *yaml.Node) {
+	if v.Kind == yaml.AliasNode {
+		v = v.Alias
+	}
+	switch {
+	case v.Kind == yaml.ScalarNode:
+		// Value is the scalar as written, so account numbers keep their
+		// leading zeros and words like null or ~ are not dropped.
+		*fields = append(*fields, field{key, v.Value})
+	case v.Style&yaml.FlowStyle != 0:
+		var value interface{}
+		if err := v.Decode(&value); err == nil {
+			if data, err := json.Marshal(value); err == nil {
+				*fields = append(*fields, field{key, string(data)})
+				return
+			}
+		}
+		// not representable as JSON, such as maps with list keys
+		*fields = append(*fields, field{key, ""})
+	case v.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(v.Content); i += 2 {
+			flattenField(fields, key+"."+v.Content[i].Value, v.Content[i+1])
+		}
+	case v.Kind == yaml.SequenceNode:
+		var values []string
+		for _, item := range v.Content {
+			if item.Kind != yaml.ScalarNode {
+				values = nil
+				break
+			}
+			values = append(values, item.Value)
+		}
+		if values != nil {
+			*fields = append(*fields, field{key, strings.Join(values, "\n")})
+			return
+		}
+		for i, item := range v.Content {
+			flattenField(fields, fmt.Sprintf("%s.%d", key, i), item)
+		}
+	}
+}
+
+// extractRecoveryCodes moves the first field matching one of aliases into the
+// notes of e, with every recovery code on its own line.
+func extractRecoveryCodes(e *entry, aliases []string) {
+	for i, fl := range e.Fields {
+		if !containsFold(aliases, fl.key) {
+			continue
+		}
+		e.Fields = append(e.Fields[:i], e.Fields[i+1:]...)
+
+		var builder strings.Builder
+		builder.WriteString("Recovery codes:\n")
+		for _, code := range strings.Split(fl.value, "\n") {
+			if code = strings.TrimSpace(code); code != "" {
+				builder.WriteString(code + "\n")
+			}
+		}
+		if e.Notes != "" {
+			e.Notes += "\n"
+		}
+		e.Notes += builder.String()
+		return
+	}
+}
+
+// extractPINs moves all fields matching one of aliases to the hidden fields
+// of e if hidden is set, or into its notes otherwise, labelled so they are
+// not mistaken for plain custom fields.
+func extractPINs(e *entry, aliases []string, hidden bool) {
+	kept := e.Fields[:0]
+	for _, fl := range e.Fields {
+		if !containsFold(aliases, fl.key) {
+			kept = append(kept, fl)
+			continue
+		}
+		if hidden {
+			e.hidden = append(e.hidden, fl)
+			continue
+		}
+		label := "PIN"
+		if !strings.EqualFold(fl.key, "pin") {
+			label = fmt.Sprintf("PIN (%s)", fl.key)
+		}
+		e.Notes += fmt.Sprintf("%s: %s\n", label, fl.value)
+	}
+	e.Fields = kept
+}
+
+// setType gives e the type typ. Notes have no login, so an entry turning
+// into a note gets its password, username, URIs and TOTP secret moved into
+// its notes as labelled lines instead of losing them.
+func setType(e *entry, typ string) {
+	if typ == "note" && e.Type != "note" {
+		for _, fl := range []field{{"username", e.LoginUsername}, {"password", e.LoginPassword},
+			{"uri", e.LoginURI}, {"totp", e.LoginTOTP}} {
+			if fl.value == "" {
+				continue
+			}
+			if e.Notes != "" && !strings.HasSuffix(e.Notes, "\n") {
+				e.Notes += "\n"
+			}
+			e.Notes += fl.key + ": " + fl.value + "\n"
+		}
+		e.LoginUsername, e.LoginPassword, e.LoginURI, e.LoginTOTP = "", "", "", ""
+	}
+	e.Type = typ
+}
+
+// extractAPICreds moves the first field matching secretAliases into the
+// password and the first matching idAliases into the username of e, when
+// e has none of its own.
+func extractAPICreds(e *entry, secretAliases, idAliases []string) {
+	move := func(target *string, aliases []string) {
+		if *target != "" {
+			return
+		}
+		for _, fl := range e.Fields {
+			if containsFold(aliases, fl.key) {
+				*target = e.Fields.pop(fl.key)
+				return
+			}
+		}
+	}
+	move(&e.LoginPassword, secretAliases)
+	move(&e.LoginUsername, idAliases)
+}
+
+// minScrubLength is the length below which secrets are not scrubbed, as
+// they would match inside unrelated words.
+const minScrubLength = 4
+
+// scrubSecrets removes every exact copy of the password and TOTP secret of
+// e from its notes.
+func scrubSecrets(e *entry) {
+	for _, secret := range []string{e.LoginPassword, e.LoginTOTP} {
+		if len(secret) >= minScrubLength {
+			e.Notes = strings.ReplaceAll(e.Notes, secret, "")
+		}
+	}
+}
+
+// renderNotes executes t for e, which replaces the custom fields of e.
+func renderNotes(t *template.Template, e *entry) (string, error) {
+	type templateField struct{ Key, Value string }
+	data := struct {
+		Notes  string
+		Fields []templateField
+	}{Notes: e.Notes}
+	for _, fl := range e.Fields {
+		data.Fields = append(data.Fields, templateField{fl.key, fl.value})
+	}
+
+	var builder strings.Builder
+	if err := t.Execute(&builder, data); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// stripControl removes control characters from s, apart from newlines and,
+// if keepTabs is set, tabs when multiline is set.
+func stripControl(s string, multiline, keepTabs bool) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsControl(r) || (multiline && (r == '\n' || (keepTabs && r == '\t'))) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// sanitizeEntry removes control characters that break importers from all
+// values of e. Passwords, TOTP secrets and hidden values are secrets and
+// kept as they are, with a warning naming fname if the password or TOTP
+// secret contains any.
+func sanitizeEntry(fname string, e *entry, keepTabs bool) {
+	for _, v := range []*string{&e.Folder, &e.Name, &e.LoginURI, &e.LoginUsername} {
+		*v = stripControl(*v, false, false)
+	}
+	for _, secret := range []string{e.LoginPassword, e.LoginTOTP} {
+		if stripControl(secret, false, false) != secret {
+			warnf("Password %s has control characters in its password or TOTP secret, kept them\n", fname)
+			break
+		}
+	}
+	e.Notes = stripControl(e.Notes, true, keepTabs)
+	for i := range e.Fields {
+		e.Fields[i].key = stripControl(e.Fields[i].key, false, false)
+		e.Fields[i].value = stripControl(e.Fields[i].value, true, keepTabs)
+	}
+	for i := range e.hidden {
+		e.hidden[i].key = stripControl(e.hidden[i].key, false, false)
+	}
+}
+
+const truncatedMarker = "…[truncated]"
+
+// truncateNotes shortens notes to at most max characters including the
+// truncation marker, cutting on a rune boundary.
+func truncateNotes(notes string, max int) (string, bool) {
+	runes := []rune(notes)
+	if len(runes) <= max {
+		return notes, false
+	}
+	keep := max - utf8.RuneCountInString(truncatedMarker)
+	if keep < 0 {
+		keep = 0
+	}
+	return string(runes[:keep]) + truncatedMarker, true
+}
+
+// filterFields removes the strip keys from fields and, if keep is not empty,
+// every key not listed in keep. Keys are matched case-insensitively.
+func filterFields(fields *fieldList, strip, keep []string) {
+	kept := (*fields)[:0]
+	for _, fl := range *fields {
+		if containsFold(strip, fl.key) || (len(keep) > 0 && !containsFold(keep, fl.key)) {
+			continue
+		}
+		kept = append(kept, fl)
+	}
+	*fields = kept
+}
+
+// renderName executes t for the entry e built from the password file
+// fname. An empty name is an error.
+func renderName(t *template.Template, fname string, e *entry) (string, error) {
+	data := struct{ Path, Folder, Name string }{
+		Path:   strings.TrimPrefix(filepath.ToSlash(strings.TrimSuffix(fname, ".gpg")), "/"),
+		Folder: folderName(e),
+		Name:   e.Name,
+	}
+	var builder strings.Builder
+	if err := t.Execute(&builder, data); err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(builder.String())
+	if name == "" {
+		return "", errors.New("template gave an empty name")
+	}
+	return name, nil
+}
+
+// normalizeKeys changes the case of all field keys, lower for lower case,
+// title for an upper case letter at the start of every word. Keys that
+// become equal are deduplicated.
+func normalizeKeys(fname string, fields fieldList, mode string) {
+	for i := range fields {
+		key := strings.ToLower(fields[i].key)
+		if mode == "title" {
+			runes := []rune(key)
+			for j, r := range runes {
+				if j == 0 || !unicode.IsLetter(runes[j-1]) && !unicode.IsDigit(runes[j-1]) {
+					runes[j] = unicode.ToUpper(r)
+				}
+			}
+			key = string(runes)
+		}
+		fields[i].key = key
+	}
+	fields.dedupe(fname)
+}
+
+// lessKey orders field keys ignoring case, and keys only differing in case
+// by their exact value.
+func lessKey(a, b string) bool {
+	if la, lb := strings.ToLower(a), strings.ToLower(b); la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+// sortFields orders fields by key, ignoring case.
+func sortFields(fields fieldList) {
+	sort.SliceStable(fields, func(i, j int) bool {
+		return lessKey(fields[i].key, fields[j].key)
+	})
+}
+
+// orderFields puts the fields listed in order first, in that order and
+// matched case-insensitively, and the other fields after them by key.
+func orderFields(fields fieldList, order []string) {
+	rank := func(key string) int {
+		for i, k := range order {
+			if strings.EqualFold(k, key) {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		ri, rj := rank(fields[i].key), rank(fields[j].key)
+		if ri != rj {
+			return ri < rj
+		}
+		return ri == len(order) && lessKey(fields[i].key, fields[j].key)
+	})
+}
+
+// readFieldOrder reads the field keys of a --field-order file, one per
+// line. Blank lines and lines starting with # are ignored.
+func readFieldOrder(name string) ([]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var order []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			order = append(order, line)
+		}
+	}
+	return order, nil
+}
+
+// renameFields applies the old=new renames to fields, matching old
+// case-insensitively. When new already exists the existing value is kept and
+// the renamed value is stored under the first free new_N key.
+func renameFields(fname string, fields fieldList, renames []string) {
+	for _, r := range renames {
+		parts := strings.SplitN(r, "=", 2)
+		for i, fl := range fields {
+			if !strings.EqualFold(fl.key, parts[0]) || fl.key == parts[1] {
+				continue
+			}
+			name := fields.freeKey(parts[1])
+			if name != parts[1] {
+				warnf("Field %s of password %s renamed to %s as %s already exists\n", fl.key, fname, name, parts[1])
+			}
+			fields[i].key = name
+		}
+	}
+}
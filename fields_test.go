@@ -0,0 +1,467 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"text/template"
+	"unicode/utf8"
+)
+
+func TestFilterFields(t *testing.T) {
+	fields := fieldList{{"created", "2020"}, {"Source", "web"}, {"pin", "1234"}, {"note", "x"}}
+	tests := []struct {
+		name        string
+		strip, keep []string
+		want        fieldList
+	}{
+		{"none", nil, nil, fields},
+		{"strip", []string{"created", "source"}, nil, fieldList{{"pin", "1234"}, {"note", "x"}}},
+		{"keep", nil, []string{"PIN", "note"}, fieldList{{"pin", "1234"}, {"note", "x"}}},
+		{"strip wins over keep", []string{"pin"}, []string{"pin", "note"}, fieldList{{"note", "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := append(fieldList(nil), fields...)
+			filterFields(&got, tt.strip, tt.keep)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		fields  fieldList
+		renames []string
+		want    fieldList
+	}{
+		{"rename", fieldList{{"pw_hint", "x"}}, []string{"pw_hint=hint"}, fieldList{{"hint", "x"}}},
+		{"case-insensitive", fieldList{{"PW_Hint", "x"}}, []string{"pw_hint=hint"}, fieldList{{"hint", "x"}}},
+		{"collision", fieldList{{"hint", "old"}, {"pw_hint", "new"}}, []string{"pw_hint=hint"}, fieldList{{"hint", "old"}, {"hint_2", "new"}}},
+		{"unknown key", fieldList{{"a", "1"}}, []string{"b=c"}, fieldList{{"a", "1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renameFields("/test.gpg", tt.fields, tt.renames)
+			if !reflect.DeepEqual(tt.fields, tt.want) {
+				t.Errorf("got %v, want %v", tt.fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestPINs(t *testing.T) {
+	const content = "pw\npin: 1234\nsite: x\n"
+	tests := []struct {
+		name       string
+		args       []string
+		wantNotes  string
+		wantHidden fieldList
+	}{
+		{"csv", nil, "PIN: 1234\n", nil},
+		{"enpass", []string{"--format", "enpass"}, "", fieldList{{"pin", "1234"}}},
+		{"kdbx", []string{"--format", "kdbx"}, "", fieldList{{"pin", "1234"}}},
+		{"upload", []string{"--upload"}, "", fieldList{{"pin", "1234"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, tt.args...), "/bank.gpg", content)
+			if e.Notes != tt.wantNotes || !reflect.DeepEqual(e.hidden, tt.wantHidden) {
+				t.Errorf("got notes %q and hidden %v, want %q and %v", e.Notes, e.hidden, tt.wantNotes, tt.wantHidden)
+			}
+			if !reflect.DeepEqual(e.Fields, fieldList{{"site", "x"}}) {
+				t.Errorf("got fields %v, want only site", e.Fields)
+			}
+		})
+	}
+}
+
+func TestHiddenFieldsStayHidden(t *testing.T) {
+	e := &entry{Name: "bank", LoginPassword: "pw", hidden: fieldList{{"pin", "1234"}}}
+	item := enpassItemFor(e)
+	want := enpassField{Label: "pin", Type: "pin", Value: "1234", Sensitive: 1}
+	if last := item.Fields[len(item.Fields)-1]; last != want {
+		t.Errorf("enpass: got %+v, want %+v", last, want)
+	}
+	bw := bwItemFor(e, nil)
+	if len(bw.Fields) != 1 || bw.Fields[0] != (bwField{Name: "pin", Value: "1234", Type: 1}) {
+		t.Errorf("upload: got %+v, want a hidden pin field", bw.Fields)
+	}
+	ke := kdbxEntryFor(e)
+	if v := ke.Get("pin"); v == nil || v.Value.Content != "1234" || !v.Value.Protected.Bool {
+		t.Errorf("kdbx: got %+v, want a protected pin value", v)
+	}
+}
+
+func TestSanitizeControl(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		content      string
+		wantPassword string
+		wantFields   fieldList
+	}{
+		{"password kept", nil, "pw\taftertab\nsite: x\n", "pw\taftertab", fieldList{{"site", "x"}}},
+		{"field tab", nil, "pw\nsite: a\tb\n", "pw", fieldList{{"site", "ab"}}},
+		{"field tab kept", []string{"--keep-tabs"}, "pw\nsite: a\tb\n", "pw", fieldList{{"site", "a\tb"}}},
+		{"invalid yaml", nil, "pw\nuser: a\x01b\nsite: x\n", "pw", fieldList{{"user", "ab"}, {"site", "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, tt.args...), "/site.gpg", tt.content)
+			if e.LoginPassword != tt.wantPassword || !reflect.DeepEqual(e.Fields, tt.wantFields) {
+				t.Errorf("got password %q and fields %v, want %q and %v", e.LoginPassword, e.Fields, tt.wantPassword, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestMapType(t *testing.T) {
+	const content = "hunter2\nlogin: alice\nurl: https://a.example\notp: JBSWY3DPEHPK3PXP\nsite: x\n"
+	tests := []struct {
+		name      string
+		mapType   string
+		wantType  string
+		wantNotes string
+		wantLogin entry
+	}{
+		{"no match", "other/*=note", "totp", "", entry{LoginUsername: "alice", LoginPassword: "hunter2",
+			LoginURI: "https://a.example", LoginTOTP: "JBSWY3DPEHPK3PXP"}},
+		{"login to note", "web/*=note", "note",
+			"username: alice\npassword: hunter2\nuri: https://a.example\ntotp: JBSWY3DPEHPK3PXP\n", entry{}},
+		{"login stays login", "web/*=login", "login", "", entry{LoginUsername: "alice", LoginPassword: "hunter2",
+			LoginURI: "https://a.example", LoginTOTP: "JBSWY3DPEHPK3PXP"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, "--map-type", tt.mapType), "/web/bank.gpg", content)
+			login := entry{LoginUsername: e.LoginUsername, LoginPassword: e.LoginPassword, LoginURI: e.LoginURI, LoginTOTP: e.LoginTOTP}
+			if e.Type != tt.wantType || e.Notes != tt.wantNotes || !reflect.DeepEqual(login, tt.wantLogin) {
+				t.Errorf("got type %q, notes %q and login %+v, want %q, %q and %+v", e.Type, e.Notes, login, tt.wantType, tt.wantNotes, tt.wantLogin)
+			}
+			if !reflect.DeepEqual(e.Fields, fieldList{{"site", "x"}}) {
+				t.Errorf("got fields %v, want only site", e.Fields)
+			}
+		})
+	}
+}
+
+func TestFolderDefaults(t *testing.T) {
+	const login = "hunter2\nlogin: alice\n"
+	tests := []struct {
+		name         string
+		args         []string
+		content      string
+		wantFavorite int
+		wantType     string
+		wantNotes    string
+	}{
+		{"favorite", []string{"--folder-default", "bank*:favorite"}, login, 1, "login", ""},
+		{"no match", []string{"--folder-default", "mail:favorite"}, login, 0, "login", ""},
+		{"note", []string{"--folder-default", "banking:type=note"}, login, 0, "note", "username: alice\npassword: hunter2\n"},
+		{"last rule wins", []string{"--folder-default", "banking:type=note", "--folder-default", "bank*:type=login"}, login, 0, "login", ""},
+		{"favorite field wins", []string{"--folder-default", "banking:favorite"}, login + "favorite: no\n", 0, "login", ""},
+		{"type field wins", []string{"--folder-default", "banking:type=note"}, login + "type: login\n", 0, "login", ""},
+		{"type field", nil, login + "type: note\n", 0, "note", "username: alice\npassword: hunter2\n"},
+		{"map-type wins", []string{"--map-type", "banking/*=note"}, login + "type: login\n", 0, "note", "username: alice\npassword: hunter2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, tt.args...), "/banking/acme.gpg", tt.content)
+			if e.Favorite != tt.wantFavorite || e.Type != tt.wantType || e.Notes != tt.wantNotes {
+				t.Errorf("got favorite %d, type %q and notes %q, want %d, %q and %q",
+					e.Favorite, e.Type, e.Notes, tt.wantFavorite, tt.wantType, tt.wantNotes)
+			}
+			if len(e.Fields) != 0 {
+				t.Errorf("got fields %v, want none", e.Fields)
+			}
+		})
+	}
+}
+
+func TestFolderDefaultsCoverSubfolders(t *testing.T) {
+	argv := parseArgv(t, "--folder-default", "banking*:favorite", "--folder-default", "banking/old:type=note")
+	tests := []struct {
+		fname        string
+		wantFavorite int
+		wantType     string
+	}{
+		{"/banking/acme.gpg", 1, "login"},
+		{"/banking/sub/acme.gpg", 1, "login"},
+		{"/banking/old/deep/acme.gpg", 1, "note"},
+		{"/banking.gpg", 0, "login"},
+		{"/web/banking/acme.gpg", 0, "login"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fname, func(t *testing.T) {
+			e := processEntry(t, argv, tt.fname, "hunter2\n")
+			if e.Favorite != tt.wantFavorite || e.Type != tt.wantType {
+				t.Errorf("got favorite %d and type %q, want %d and %q", e.Favorite, e.Type, tt.wantFavorite, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		content   string
+		wantNotes string
+	}{
+		{"block", nil, "pw\nrecovery: |\n  1111-2222\n  3333-4444\n\n  5555-6666\nsite: x\n",
+			"Recovery codes:\n1111-2222\n3333-4444\n5555-6666\n"},
+		{"alias with space", nil, "pw\nbackup codes: \"aaaa\\nbbbb\"\nsite: x\n", "Recovery codes:\naaaa\nbbbb\n"},
+		{"after notes", []string{"--password-line", "2"}, "comment\npw\nsite: x\nrecovery: cccc\n", "comment\n\nRecovery codes:\ncccc\n"},
+		{"own alias", []string{"--recovery-field", "2fa-backup"}, "pw\n2FA-Backup: dddd\nsite: x\n", "Recovery codes:\ndddd\n"},
+		{"own alias replaces defaults", []string{"--recovery-field", "2fa-backup"}, "pw\nrecovery: eeee\nsite: x\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, tt.args...), "/site.gpg", tt.content)
+			if e.Notes != tt.wantNotes {
+				t.Errorf("got notes %q, want %q", e.Notes, tt.wantNotes)
+			}
+			if _, ok := e.Fields.lookup("site"); !ok {
+				t.Errorf("got fields %v, want the site field kept", e.Fields)
+			}
+		})
+	}
+}
+
+func TestNotesTemplate(t *testing.T) {
+	const content = "pw\nsite: shop\nid: 0042\n"
+	tests := []struct {
+		name      string
+		args      []string
+		template  string
+		wantNotes string
+		wantKept  bool
+	}{
+		{"default", nil, "", "", true},
+		{"template", nil, "{{range .Fields}}* {{.Key}} = {{.Value}}\n{{end}}", "* site = shop\n* id = 0042\n", false},
+		{"prefix and suffix", []string{"--notes-prefix", "Migrated from pass\n", "--notes-suffix", "(end)\n"}, "",
+			"Migrated from pass\n(end)\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv := parseArgv(t, tt.args...)
+			if tt.template != "" {
+				argv.notesTemplate = template.Must(template.New("notes").Parse(tt.template))
+			}
+			e := processEntry(t, argv, "/shop.gpg", content)
+			if e.Notes != tt.wantNotes {
+				t.Errorf("got notes %q, want %q", e.Notes, tt.wantNotes)
+			}
+			if kept := len(e.Fields) == 2; kept != tt.wantKept {
+				t.Errorf("got fields %v, want them kept: %v", e.Fields, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestInvalidNotesTemplate(t *testing.T) {
+	if err := runArgs("--no-unlock", "--notes-template", "{{.Nope", "--password-store", t.TempDir()); !errors.Is(err, errUsage) {
+		t.Errorf("got %v, want %v", err, errUsage)
+	}
+}
+
+func TestTruncateNotes(t *testing.T) {
+	tests := []struct {
+		name, notes string
+		max         int
+		want        string
+		truncated   bool
+	}{
+		{"short", "hello", 20, "hello", false},
+		{"exact", "hello", 5, "hello", false},
+		{"ascii", strings.Repeat("a", 30), 20, "aaaaaaaa…[truncated]", true},
+		{"multibyte", strings.Repeat("ä", 30), 20, "ääääääää…[truncated]", true},
+		{"emoji", strings.Repeat("🔑", 30), 14, "🔑🔑…[truncated]", true},
+		{"shorter than the marker", strings.Repeat("a", 30), 5, "…[truncated]", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncateNotes(tt.notes, tt.max)
+			if got != tt.want || truncated != tt.truncated {
+				t.Errorf("got %q, %v, want %q, %v", got, truncated, tt.want, tt.truncated)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("%q is not valid UTF-8", got)
+			}
+		})
+	}
+}
+
+func TestNormalizeKeys(t *testing.T) {
+	tests := []struct {
+		name, mode string
+		fields     fieldList
+		want       []string
+	}{
+		{"lower", "lower", fieldList{{"API_Key", "a"}, {"Security Question", "b"}}, []string{"api_key", "security question"}},
+		{"title", "title", fieldList{{"api_key", "a"}, {"security QUESTION", "b"}, {"2fa-backup", "c"}}, []string{"Api_Key", "Security Question", "2fa-Backup"}},
+		{"converging keys", "lower", fieldList{{"API_Key", "a"}, {"api_key", "b"}}, []string{"api_key", "api_key_2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalizeKeys("/api.gpg", tt.fields, tt.mode)
+			var got []string
+			for _, fl := range tt.fields {
+				got = append(got, fl.key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeKeysAcrossEntries(t *testing.T) {
+	files := map[string]string{"a": "pw\nAPI_Key: 1\n", "b": "pw\napi_key: 2\n", "c": "pw\nApi_key: 3\n"}
+	out, err := exportStore(t, files, "--normalize-keys", "lower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range csvRows(t, out) {
+		if !strings.HasPrefix(row["fields"], "api_key: ") {
+			t.Errorf("%s: got fields %q, want an api_key field", row["name"], row["fields"])
+		}
+	}
+}
+
+func TestAPICreds(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		content      string
+		wantPassword string
+		wantUsername string
+		wantFields   fieldList
+	}{
+		{"off", nil, "\nclient_id: abc\nclient_secret: s3cret\n", "", "", fieldList{{"client_id", "abc"}, {"client_secret", "s3cret"}}},
+		{"client credentials", []string{"--detect-api-creds"}, "\nclient_id: abc\nclient_secret: s3cret\nscope: read\n", "s3cret", "abc", fieldList{{"scope", "read"}}},
+		{"labelled first line", []string{"--detect-api-creds"}, "api_key: k3y\nendpoint: https://api.example.com\n", "k3y", "", fieldList{{"endpoint", "https://api.example.com"}}},
+		{"aws", []string{"--detect-api-creds"}, "\naccess_key_id: AKIA\nsecret_access_key: wJal\n", "wJal", "AKIA", fieldList{}},
+		{"own password wins", []string{"--detect-api-creds"}, "pw\nlogin: me\ntoken: t0k\n", "pw", "me", fieldList{{"token", "t0k"}}},
+		{"custom aliases", []string{"--detect-api-creds", "--api-secret-field", "bearer", "--api-id-field", "app"}, "\napp: myapp\nbearer: b\ntoken: t\n", "b", "myapp", fieldList{{"token", "t"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, tt.args...), "/api.gpg", tt.content)
+			if e.LoginPassword != tt.wantPassword || e.LoginUsername != tt.wantUsername || !reflect.DeepEqual(e.Fields, tt.wantFields) {
+				t.Errorf("got password %q, username %q and fields %v, want %q, %q and %v",
+					e.LoginPassword, e.LoginUsername, e.Fields, tt.wantPassword, tt.wantUsername, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestScrubSecrets(t *testing.T) {
+	tests := []struct {
+		name, password, totp, notes, want string
+	}{
+		{"password", "hunter2", "", "old password was hunter2, do not use\n", "old password was , do not use\n"},
+		{"every copy", "hunter2", "", "hunter2\nhunter2\n", "\n\n"},
+		{"totp", "pw", "JBSWY3DPEHPK3PXP", "seed: JBSWY3DPEHPK3PXP\n", "seed: \n"},
+		{"exact only", "hunter2", "", "Hunter2 hunter 2\n", "Hunter2 hunter 2\n"},
+		{"short password", "pw", "", "pwd is in the wiki\n", "pwd is in the wiki\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &entry{LoginPassword: tt.password, LoginTOTP: tt.totp, Notes: tt.notes}
+			scrubSecrets(e)
+			if e.Notes != tt.want || e.LoginPassword != tt.password || e.LoginTOTP != tt.totp {
+				t.Errorf("got notes %q, password %q and TOTP %q, want %q and the secrets kept", e.Notes, e.LoginPassword, e.LoginTOTP, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrubDuplicatedSecrets(t *testing.T) {
+	const content = "hunter2\nlogin: me\nthe password is hunter2\n"
+	for _, args := range [][]string{nil, {"--scrub-duplicated-secrets"}} {
+		e := processEntry(t, parseArgv(t, append(args, "--strict-fields")...), "/shop.gpg", content)
+		if got := strings.Contains(e.Notes, "hunter2"); got != (args == nil) || e.LoginPassword != "hunter2" {
+			t.Errorf("%q: got notes %q and password %q", args, e.Notes, e.LoginPassword)
+		}
+	}
+}
+
+func TestNestedFields(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "yaml", "nested.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := buildEntry(parseArgv(t), "/shop.gpg", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.LoginTOTP != "JBSWY3DPEHPK3PXP" || e.LoginPassword != "hunter2" || e.LoginUsername != "me" {
+		t.Errorf("got TOTP %q, password %q and username %q", e.LoginTOTP, e.LoginPassword, e.LoginUsername)
+	}
+	want := fieldList{
+		{"otp.digits", "6"},
+		{"otp.period", "30"},
+		{"security.questions.0.q", "first pet"},
+		{"security.questions.0.a", "rex"},
+		{"security.questions.1.q", "city"},
+		{"security.questions.1.a", "berlin"},
+		{"aliases", "me@example.com\nme@example.org"},
+		{"address", `{"street":"Main St 1","zip":"01234"}`},
+	}
+	if !reflect.DeepEqual(e.Fields, want) {
+		t.Errorf("got fields %v, want %v", e.Fields, want)
+	}
+}
+
+func TestOrderFields(t *testing.T) {
+	order := []string{"account", "Region", "support"}
+	tests := []struct {
+		name   string
+		fields fieldList
+		want   fieldList
+	}{
+		{"listed first", fieldList{{"zone", "1"}, {"support", "2"}, {"account", "3"}}, fieldList{{"account", "3"}, {"support", "2"}, {"zone", "1"}}},
+		{"case-insensitive", fieldList{{"region", "eu"}, {"ACCOUNT", "7"}}, fieldList{{"ACCOUNT", "7"}, {"region", "eu"}}},
+		{"rest by key", fieldList{{"beta", "1"}, {"Alpha", "2"}, {"account", "3"}}, fieldList{{"account", "3"}, {"Alpha", "2"}, {"beta", "1"}}},
+		{"repeated keys keep their order", fieldList{{"support", "b"}, {"support", "a"}}, fieldList{{"support", "b"}, {"support", "a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderFields(tt.fields, order)
+			if !reflect.DeepEqual(tt.fields, tt.want) {
+				t.Errorf("got %v, want %v", tt.fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldOrderFile(t *testing.T) {
+	order := filepath.Join(t.TempDir(), "order.txt")
+	if err := os.WriteFile(order, []byte("# shared layout\naccount\n\n  region  \nsupport\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"a": "pw\nzone: 1\nsupport: s\nbeta: b\naccount: 1\n",
+		"b": "pw\nregion: eu\nalpha: a\naccount: 2\n",
+	}
+	out, err := exportStore(t, files, "--field-order", order, "--sort", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range csvRows(t, out) {
+		got = append(got, row["fields"])
+	}
+	want := []string{"account: 1\nsupport: s\nbeta: b\nzone: 1\n", "account: 2\nregion: eu\nalpha: a\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// format is an output format selected with --format.
+type format struct {
+	// totp is the TOTP representation the importer expects, see
+	// convertTOTP.
+	totp string
+	// ext is the file extension used by --per-entry.
+	ext string
+	// hidden reports whether the format has fields with hidden values,
+	// which PINs are kept in instead of the notes.
+	hidden bool
+	write  func(out io.Writer, entries <-chan *entry) error
+}
+
+var formats = map[string]format{
+	// Bitwarden accepts both bare secrets and otpauth URIs.
+	"bitwarden": {totp: totpKeep, ext: ".csv", write: writeCSV},
+	"nordpass":  {totp: totpKeep, ext: ".csv", write: writeNordPass},
+	// Dashlane only reads bare secrets from its otpSecret column.
+	"dashlane": {totp: totpBare, ext: ".csv", write: writeDashlane},
+	"enpass":   {totp: totpKeep, ext: ".json", hidden: true, write: writeEnpass},
+	"roboform": {totp: totpKeep, ext: ".csv", write: writeRoboForm},
+	// the URI keeps digits and algorithm for the migration payload
+	"totp-migration": {totp: totpURI, ext: ".txt", write: writeTOTPMigration},
+	"raw":            {totp: totpKeep, ext: ".jsonl", write: writeRaw},
+	// KeePassXC reads otpauth URIs from its otp field
+	"kdbx": {totp: totpURI, ext: ".kdbx", hidden: true, write: writeKDBXUnset},
+}
+
+func formatNames() string {
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// folderName returns the folder of e, or nothing for the store root.
+func folderName(e *entry) string {
+	if e.Folder == "/" {
+		return ""
+	}
+	return e.Folder
+}
+
+// notesWithFields returns the notes of e followed by its custom fields, for
+// formats without a place for custom fields.
+func notesWithFields(e *entry) string {
+	fields, _ := e.Fields.MarshalCSV()
+	if e.Notes != "" && fields != "" && !strings.HasSuffix(e.Notes, "\n") {
+		return e.Notes + "\n" + fields
+	}
+	return e.Notes + fields
+}
+
+// notesWithTOTP is notesWithFields with the TOTP secret of e added as a
+// last field.
+func notesWithTOTP(e *entry) string {
+	note := notesWithFields(e)
+	if e.LoginTOTP != "" {
+		note += "totp: " + e.LoginTOTP + "\n"
+	}
+	return note
+}
+
+// writeColumns writes entries as CSV with the given header, using row to
+// build the record of every entry.
+func writeColumns(out io.Writer, header []string, row func(e *entry) []string, entries <-chan *entry) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	for e := range entries {
+		if err := w.Write(row(e)); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+var nordPassHeader = []string{
+	"name", "url", "username", "password", "note", "cardholdername", "cardnumber", "cvc",
+	"expirydate", "zipcode", "folder", "full_name", "phone_number", "email", "address1",
+	"address2", "city", "country", "state",
+}
+
+// writeNordPass writes entries in the CSV layout of the NordPass importer.
+// NordPass has no column for custom fields or TOTP secrets, both end up in
+// the note.
+func writeNordPass(out io.Writer, entries <-chan *entry) error {
+	return writeColumns(out, nordPassHeader, func(e *entry) []string {
+		note := notesWithTOTP(e)
+		row := make([]string, len(nordPassHeader))
+		row[0] = e.Name
+		row[1] = e.LoginURI
+		row[2] = e.LoginUsername
+		row[3] = e.LoginPassword
+		row[4] = note
+		row[10] = folderName(e)
+		return row
+	}, entries)
+}
+
+var dashlaneHeader = []string{
+	"username", "username2", "username3", "title", "password", "note", "url", "otpSecret", "category",
+}
+
+// writeDashlane writes entries in the CSV layout of the Dashlane importer.
+// The username2 and username3 columns are only filled for entries with
+// more than one username, an email or username2/username3 field next to
+// the login.
+func writeDashlane(out io.Writer, entries <-chan *entry) error {
+	return writeColumns(out, dashlaneHeader, func(e *entry) []string {
+		fields := append(fieldList(nil), e.Fields...)
+		var usernames []string
+		for _, key := range []string{"username2", "username3", "email"} {
+			if len(usernames) < 2 && fields.has(key) {
+				usernames = append(usernames, fields.pop(key))
+			}
+		}
+		usernames = append(usernames, "", "")
+		rest := *e
+		rest.Fields = fields
+		return []string{
+			e.LoginUsername, usernames[0], usernames[1], e.Name, e.LoginPassword,
+			notesWithFields(&rest), e.LoginURI, e.LoginTOTP, folderName(e),
+		}
+	}, entries)
+}
+
+type enpassExport struct {
+	Folders []enpassFolder `json:"folders"`
+	Items   []enpassItem   `json:"items"`
+}
+
+type enpassFolder struct {
+	UUID  string `json:"uuid"`
+	Title string `json:"title"`
+}
+
+type enpassItem struct {
+	Title    string        `json:"title"`
+	Category string        `json:"category"`
+	Folders  []string      `json:"folders,omitempty"`
+	Note     string        `json:"note"`
+	Fields   []enpassField `json:"fields"`
+}
+
+type enpassField struct {
+	Label     string `json:"label"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Sensitive int    `json:"sensitive"`
+}
+
+// enpassFolderUUID derives the folder UUID from its path, so repeated
+// exports of the same store give the same UUIDs.
+func enpassFolderUUID(folder string) string {
+	h := sha256.Sum256([]byte(folder))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// enpassItemFor maps e to an Enpass login, or a note for note entries.
+// Username, password, url and TOTP become typed fields, custom fields
+// become text fields and hidden fields sensitive pin fields.
+func enpassItemFor(e *entry) enpassItem {
+	item := enpassItem{Title: e.Name, Category: "login", Note: e.Notes, Fields: []enpassField{}}
+	if e.Type == "note" {
+		item.Category = "note"
+	}
+	add := func(label, typ, value string, sensitive bool) {
+		if value == "" {
+			return
+		}
+		f := enpassField{Label: label, Type: typ, Value: value}
+		if sensitive {
+			f.Sensitive = 1
+		}
+		item.Fields = append(item.Fields, f)
+	}
+	add("Username", "username", e.LoginUsername, false)
+	add("Password", "password", e.LoginPassword, true)
+	add("Website", "url", e.LoginURI, false)
+	add("TOTP", "totp", e.LoginTOTP, true)
+	for _, fl := range e.Fields {
+		add(fl.key, "text", fl.value, false)
+	}
+	for _, fl := range e.hidden {
+		add(fl.key, "pin", fl.value, true)
+	}
+	return item
+}
+
+// writeEnpass writes entries as an Enpass JSON import. Folders are only
+// known once every entry has been read, so the whole export is buffered.
+func writeEnpass(out io.Writer, entries <-chan *entry) error {
+	export := enpassExport{Folders: []enpassFolder{}, Items: []enpassItem{}}
+	seen := map[string]bool{}
+	for e := range entries {
+		item := enpassItemFor(e)
+		if folder := folderName(e); folder != "" {
+			uuid := enpassFolderUUID(folder)
+			if !seen[folder] {
+				seen[folder] = true
+				export.Folders = append(export.Folders, enpassFolder{UUID: uuid, Title: folder})
+			}
+			item.Folders = []string{uuid}
+		}
+		export.Items = append(export.Items, item)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+var roboFormHeader = []string{"Url", "Name", "MatchUrl", "Login", "Pwd", "Note", "Folder", "RfFieldsV2"}
+
+// writeRoboForm writes entries in the CSV layout of the RoboForm importer.
+// MatchUrl is the first url of the entry, custom fields and TOTP secrets
+// end up in the note.
+func writeRoboForm(out io.Writer, entries <-chan *entry) error {
+	return writeColumns(out, roboFormHeader, func(e *entry) []string {
+		note := notesWithTOTP(e)
+		matchURL := strings.SplitN(e.LoginURI, ",", 2)[0]
+		return []string{e.LoginURI, e.Name, matchURL, e.LoginUsername, e.LoginPassword, note, folderName(e), ""}
+	}, entries)
+}
+
+var bitwardenColumns = []string{
+	"folder", "favorite", "type", "name", "notes", "login_uri", "login_username", "login_password", "login_totp",
+}
+
+// writeFlatCSV writes entries in the Bitwarden layout with a column per
+// custom field key instead of the fields column. The columns are only
+// known once every entry has been read, so the whole export is buffered.
+// Keys that would repeat a column name, such as a name field, get a
+// field_ prefix.
+func writeFlatCSV(out io.Writer, entries <-chan *entry) error {
+	var all []*entry
+	var keys []string
+	seen := map[string]bool{}
+	for e := range entries {
+		all = append(all, e)
+		for _, fl := range e.Fields {
+			if !seen[fl.key] {
+				seen[fl.key] = true
+				keys = append(keys, fl.key)
+			}
+		}
+	}
+
+	buffered := make(chan *entry, len(all))
+	for _, e := range all {
+		buffered <- e
+	}
+	close(buffered)
+	header := append([]string(nil), bitwardenColumns...)
+	taken := map[string]bool{}
+	for _, column := range bitwardenColumns {
+		taken[column] = true
+	}
+	for _, key := range keys {
+		column := key
+		for taken[strings.ToLower(column)] {
+			column = "field_" + column
+		}
+		taken[strings.ToLower(column)] = true
+		header = append(header, column)
+	}
+	return writeColumns(out, header, func(e *entry) []string {
+		record := csvRecord(e)
+		row := make([]string, 0, len(header))
+		for _, column := range bitwardenColumns {
+			row = append(row, record[column])
+		}
+		for _, key := range keys {
+			value, _ := e.Fields.lookup(key)
+			row = append(row, value)
+		}
+		return row
+	}, buffered)
+}
+
+// columnWriter returns a writer of the Bitwarden layout reduced to columns,
+// in the given order.
+func columnWriter(columns []string) func(io.Writer, <-chan *entry) error {
+	return func(out io.Writer, entries <-chan *entry) error {
+		return writeColumns(out, columns, func(e *entry) []string {
+			record := csvRecord(e)
+			row := make([]string, len(columns))
+			for i, column := range columns {
+				row[i] = record[column]
+			}
+			return row
+		}, entries)
+	}
+}
+
+// rawEntry is a line of the raw format.
+type rawEntry struct {
+	Folder  string `json:"folder"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// writeRaw writes a JSON object per line with the folder, name and
+// decrypted content of every entry, exactly as in the password file.
+// Entries not read from a password file, such as attachments, get a body
+// of the password, the fields and the notes.
+func writeRaw(out io.Writer, entries <-chan *entry) error {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	for e := range entries {
+		content := e.raw
+		if content == "" {
+			var builder strings.Builder
+			builder.WriteString(e.LoginPassword + "\n")
+			for _, fl := range e.Fields {
+				fmt.Fprintf(&builder, "%s: %s\n", fl.key, fl.value)
+			}
+			builder.WriteString(e.Notes)
+			content = builder.String()
+		}
+		if err := enc.Encode(rawEntry{folderName(e), e.Name, content}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
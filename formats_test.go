@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// sampleEntry is a login using every column the formats know.
+func sampleEntry() *entry {
+	return &entry{
+		Folder:        "web/shops",
+		Name:          "shop",
+		Notes:         "customer since 2019\n",
+		Fields:        fieldList{{"customer_id", "4711"}, {"email", "alice@example.com"}},
+		LoginURI:      "https://shop.example,https://shop.example/login",
+		LoginUsername: "alice",
+		LoginPassword: "hunter2",
+		LoginTOTP:     "JBSWY3DPEHPK3PXP",
+	}
+}
+
+// checkGolden writes entries with write and compares the output to the
+// golden file testdata/name.
+func checkGolden(t *testing.T, name string, write func(io.Writer, <-chan *entry) error, entries ...*entry) {
+	t.Helper()
+	var out bytes.Buffer
+	if err := write(&out, entryChan(entries...)); err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(golden, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("got\n%s\nwant\n%s", out.Bytes(), want)
+	}
+}
+
+func TestWriteNordPass(t *testing.T) {
+	checkGolden(t, "nordpass.csv", writeNordPass, sampleEntry())
+}
+
+func TestWriteDashlane(t *testing.T) {
+	second := sampleEntry()
+	second.Name = "forum"
+	second.Fields = fieldList{{"username2", "bob"}}
+	checkGolden(t, "dashlane.csv", writeDashlane, sampleEntry(), second)
+}
+
+func TestWriteEnpass(t *testing.T) {
+	note := &entry{Folder: "/", Name: "wifi", Type: "note", Notes: "ssid: home\n"}
+	checkGolden(t, "enpass.json", writeEnpass, sampleEntry(), note)
+}
+
+func TestWriteRoboForm(t *testing.T) {
+	checkGolden(t, "roboform.csv", writeRoboForm, sampleEntry())
+}
+
+func TestWriteFlatCSV(t *testing.T) {
+	first := &entry{Folder: "/", Name: "a", LoginPassword: "pw", Fields: fieldList{{"pin", "1"}, {"name", "alias"}}}
+	second := &entry{Folder: "/", Name: "b", Fields: fieldList{{"Notes", "x"}, {"field_name", "taken"}, {"pin", "2"}}}
+	checkGolden(t, "flat.csv", writeFlatCSV, first, second)
+}
+
+func TestCSVColumns(t *testing.T) {
+	files := map[string]string{"work/github": "pw\nlogin: me\nurl: https://github.com\n"}
+	tests := []struct {
+		name    string
+		columns string
+		want    string
+	}{
+		{"subset", "folder,name,login_username,login_password", "folder,name,login_username,login_password\nwork,github,me,pw\n"},
+		{"reordered", "login_password, name", "login_password,name\npw,github\n"},
+		{"repeated", "name,name", "name,name\ngithub,github\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, files, "--csv-columns", tt.columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != tt.want {
+				t.Errorf("got %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVColumnsValidated(t *testing.T) {
+	for _, args := range [][]string{
+		{"--csv-columns", "name,password"},
+		{"--csv-columns", "name", "--format", "nordpass"},
+		{"--csv-columns", "name", "--flatten-fields"},
+	} {
+		if _, err := exportStore(t, map[string]string{"a": "pw\n"}, args...); !errors.Is(err, errUsage) {
+			t.Errorf("%q: got %v, want %v", args, err, errUsage)
+		}
+	}
+}
+
+func TestRawFormat(t *testing.T) {
+	files := map[string]string{
+		"mail":        "pw\n",
+		"web/shop":    "hunter2\nlogin: me\nurl: https://shop.example.com\npin: 0042\n",
+		"no-newline":  "pw\nlogin: me",
+		"crlf":        "pw\r\nlogin: me\r\n",
+		"otp":         "pw\notpauth://totp/x?secret=JBSWY3DPEHPK3PXP\n",
+		"blank first": "\nsome notes: <b>here</b> & there\n\n",
+		"unicode":     "pässwörd 🔑\nnotes\twith tabs\n",
+	}
+	out, err := exportStore(t, files, "--format", "raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		var r rawEntry
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("reading %q: %v", line, err)
+		}
+		path := r.Name
+		if r.Folder != "" {
+			path = r.Folder + "/" + r.Name
+		}
+		got[path] = r.Content
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Errorf("got %q, want %q", got, files)
+	}
+}
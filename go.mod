@@ -3,18 +3,25 @@ module github.com/andresterba/pass2bitwarden
 go 1.17
 
 require (
+	github.com/atotto/clipboard v0.1.4
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/gocarina/gocsv v0.0.0-20190131101517-2a8c07cdf701
+	github.com/mattn/go-isatty v0.0.4
 	github.com/mkideal/cli v0.2.1-0.20190117035342-a48c2cee5b5e
+	github.com/tobischo/gokeepasslib/v3 v3.4.1
+	golang.org/x/term v0.1.0
+	golang.org/x/text v0.3.8
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/Bowery/prompt v0.0.0-20180817134258-8a1d5376df1c // indirect
+	github.com/aead/argon2 v0.0.0-20180111183520-a87724528b07 // indirect
+	github.com/aead/chacha20 v0.0.0-20180709150244-8b13a72661da // indirect
 	github.com/labstack/gommon v0.2.8 // indirect
 	github.com/mattn/go-colorable v0.1.0 // indirect
-	github.com/mattn/go-isatty v0.0.4 // indirect
 	github.com/mkideal/pkg v0.0.0-20170503154153-3e188c9e7ecc // indirect
 	github.com/stretchr/testify v1.7.0 // indirect
 	golang.org/x/crypto v0.0.0-20211202192323-5770296d904e // indirect
-	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	golang.org/x/sys v0.0.0-20220908164124-27713097b956 // indirect
 )
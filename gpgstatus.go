@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// gpgStatus holds the keywords of the status lines gpg wrote with
+// --status-fd, such as NO_SECKEY or BAD_PASSPHRASE.
+type gpgStatus map[string]bool
+
+// parseGPGStatus reads the status lines gpg wrote to r, ignoring anything
+// else.
+func parseGPGStatus(r io.Reader) gpgStatus {
+	status := gpgStatus{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "[GNUPG:]" {
+			status[fields[1]] = true
+		}
+	}
+	return status
+}
+
+// failureReason explains a failed decryption from what gpg reported,
+// falling back to err. What gpg wrote to stderr is kept in either case.
+func (s gpgStatus) failureReason(err error) string {
+	var said string
+	var gerr gpgError
+	if errors.As(err, &gerr) {
+		said = ", gpg said: " + gerr.stderr
+	}
+	switch {
+	case s["BAD_PASSPHRASE"]:
+		return "bad passphrase" + said
+	case s["NO_SECKEY"]:
+		return "no secret key available for any recipient" + said
+	// gpg finds no OpenPGP data in a corrupt file, otherwise decryption
+	// mostly fails because the agent could not ask for the passphrase
+	case s["DECRYPTION_FAILED"] && s["NODATA"]:
+		return "decryption failed, the file may be corrupt" + said
+	case s["DECRYPTION_FAILED"]:
+		return "decryption failed, check that gpg-agent and pinentry can ask for the passphrase" + said
+	}
+	return "could not decrypt: " + err.Error()
+}
+
+// gpgError is a failed gpg call and the lines it wrote to stderr.
+type gpgError struct {
+	error
+	stderr string
+}
+
+func (e gpgError) Error() string { return e.error.Error() + ", gpg said: " + e.stderr }
+
+func (e gpgError) Unwrap() error { return e.error }
+
+// runDecrypt decrypts path, collecting the gpg status lines on a file
+// descriptor of their own so they do not mix with its stderr.
+func runDecrypt(path string, passphrase []byte) ([]byte, gpgStatus, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	cmd := decryptCommand(path, passphrase)
+	// the first extra file is fd 3 in gpg
+	cmd.Args = append(cmd.Args[:1], append([]string{"--status-fd", "3"}, cmd.Args[1:]...)...)
+	cmd.ExtraFiles = []*os.File{w}
+
+	// gpg stderr, such as prompts of an agent that is not running, is
+	// only shown for the password that failed
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	statusc := make(chan gpgStatus, 1)
+	go func() { statusc <- parseGPGStatus(r) }()
+	out, err := cmd.Output()
+	w.Close()
+	if err != nil {
+		var lines []string
+		for _, line := range strings.Split(stderr.String(), "\n") {
+			if line = strings.TrimSpace(strings.TrimPrefix(line, "gpg: ")); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) > 0 {
+			err = gpgError{err, strings.Join(lines, "; ")}
+		}
+	}
+	return out, <-statusc, err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseGPGStatus(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    string
+	}{
+		{"bad-passphrase.txt", "bad passphrase"},
+		{"no-seckey.txt", "no secret key available for any recipient"},
+		{"corrupt.txt", "decryption failed, the file may be corrupt"},
+		{"no-pinentry.txt", "decryption failed, check that gpg-agent and pinentry can ask for the passphrase"},
+		{"success.txt", "could not decrypt: exit status 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "gpgstatus", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			status := parseGPGStatus(f)
+			if got := status.failureReason(errors.New("exit status 2")); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGPGStatusIgnoresOtherLines(t *testing.T) {
+	status := parseGPGStatus(strings.NewReader("gpg: decryption failed: No secret key\n[GNUPG:]\nNO_SECKEY x\n[GNUPG:] DECRYPTION_OKAY\n"))
+	if len(status) != 1 || !status["DECRYPTION_OKAY"] {
+		t.Errorf("got %v, want only DECRYPTION_OKAY", status)
+	}
+}
+
+func TestGPGStderrBelongsToItsPassword(t *testing.T) {
+	// every call prompts, only the files named broken fail, each with a
+	// message of its own, and broken-b with a status line
+	fakeGPG(t, `for last; do :; done
+echo "Please enter the passphrase to unlock the OpenPGP secret key" >&2
+case "$last" in *broken-b*) echo "[GNUPG:] NO_SECKEY 0123456789ABCDEF" >&3;; esac
+case "$last" in *broken*) echo "gpg: decryption of $(basename "$last") failed" >&2; exit 2;; esac
+cat "$last"`)
+	store := writeStore(t, map[string]string{"mail": "pw\n", "broken-a": "pw\n", "web/broken-b": "pw\n"})
+	report := filepath.Join(t.TempDir(), "report.json")
+	var err error
+	stderr := capture(t, &os.Stderr, func() {
+		err = runArgs("--no-unlock", "--password-store", store, "-o", filepath.Join(t.TempDir(), "out"), "--report-json", report)
+	})
+	if !errors.Is(err, errPartial) {
+		t.Fatalf("got %v, want %v", err, errPartial)
+	}
+
+	// one prompt per failed password, none for mail
+	if n := strings.Count(stderr, "Please enter the passphrase"); n != 2 {
+		t.Errorf("got %d prompts on stderr, want the 2 of the failed passwords:\n%s", n, stderr)
+	}
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r struct{ Failed []failure }
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, f := range r.Failed {
+		got[f.Name] = f.Reason
+	}
+	want := map[string]struct{ reason, msg string }{
+		"/broken-a.gpg":     {"could not decrypt: ", "decryption of broken-a.gpg failed"},
+		"/web/broken-b.gpg": {"no secret key available for any recipient, gpg said: ", "decryption of broken-b.gpg failed"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got failures %q, want %q", got, want)
+	}
+	for name, w := range want {
+		if !strings.HasPrefix(got[name], w.reason) {
+			t.Errorf("%s: got %q, want it to start with %q", name, got[name], w.reason)
+		}
+		if !strings.Contains(got[name], w.msg) || strings.Count(got[name], "decryption of") != 1 {
+			t.Errorf("%s: got %q, want only its own message %q", name, got[name], w.msg)
+		}
+	}
+}
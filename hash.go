@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// hashField is the custom field --with-hash stores the content hash in.
+const hashField = "content_hash"
+
+// contentHash returns the hex SHA-256 of the folder, name, type, favorite,
+// notes, URIs, username, password, TOTP secret, custom fields and hidden
+// fields of e, in this order and the fields in the order they are
+// exported. Every value is written with its length, so values cannot run
+// into each other. A content_hash field is not part of the hash.
+func contentHash(e *entry) string {
+	h := sha256.New()
+	write := func(s string) { fmt.Fprintf(h, "%d:%s", len(s), s) }
+	for _, v := range []string{e.Folder, e.Name, e.Type, fmt.Sprint(e.Favorite), e.Notes,
+		e.LoginURI, e.LoginUsername, e.LoginPassword, e.LoginTOTP} {
+		write(v)
+	}
+	for _, fl := range e.Fields {
+		if fl.key != hashField {
+			write(fl.key)
+			write(fl.value)
+		}
+	}
+	for _, fl := range e.hidden {
+		write(fl.key)
+		write(fl.value)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashEntries passes entries on with their contentHash in the content_hash
+// field, replacing any such field of the password file.
+func hashEntries(entries <-chan *entry) <-chan *entry {
+	c := make(chan *entry)
+	go func() {
+		defer close(c)
+		for e := range entries {
+			sum := contentHash(e)
+			e.Fields.popAll(hashField)
+			e.Fields = append(e.Fields, field{hashField, sum})
+			c <- e
+		}
+	}()
+	return c
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestContentHash(t *testing.T) {
+	base := func() *entry {
+		return &entry{Folder: "web", Name: "shop", Type: "login", LoginUsername: "me", LoginPassword: "hunter2",
+			LoginURI: "https://shop.example.com", Notes: "notes\n", Fields: fieldList{{"account", "0042"}}}
+	}
+	tests := []struct {
+		name   string
+		change func(e *entry)
+		same   bool
+	}{
+		{"identical", func(e *entry) {}, true},
+		{"old hash field", func(e *entry) { e.Fields = append(e.Fields, field{hashField, "old"}) }, true},
+		{"password", func(e *entry) { e.LoginPassword = "hunter3" }, false},
+		{"username", func(e *entry) { e.LoginUsername = "you" }, false},
+		{"folder", func(e *entry) { e.Folder = "shop" }, false},
+		{"notes", func(e *entry) { e.Notes = "" }, false},
+		{"favorite", func(e *entry) { e.Favorite = 1 }, false},
+		{"field value", func(e *entry) { e.Fields[0].value = "42" }, false},
+		{"hidden field", func(e *entry) { e.hidden = fieldList{{"pin", "1234"}} }, false},
+		{"values running into each other", func(e *entry) { e.Folder, e.Name = "webs", "hop" }, false},
+	}
+	want := contentHash(base())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := base()
+			tt.change(e)
+			if got := contentHash(e); (got == want) != tt.same {
+				t.Errorf("got %s, want it equal to %s: %v", got, want, tt.same)
+			}
+		})
+	}
+}
+
+func TestHashEntries(t *testing.T) {
+	entries := collect(hashEntries(entryChan(
+		&entry{Name: "a", LoginPassword: "pw", Fields: fieldList{{hashField, "stale"}}},
+		&entry{Name: "a", LoginPassword: "pw"},
+	)))
+	for _, e := range entries {
+		if len(e.Fields) != 1 || e.Fields[0].key != hashField || len(e.Fields[0].value) != 64 {
+			t.Fatalf("got fields %v, want a single %s field", e.Fields, hashField)
+		}
+	}
+	if entries[0].Fields[0].value != entries[1].Fields[0].value {
+		t.Errorf("identical entries hash to %s and %s", entries[0].Fields[0].value, entries[1].Fields[0].value)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// redact hides value unless secrets are shown, keeping its length as a
+// hint.
+func redact(value string, show bool) string {
+	if show || value == "" {
+		return value
+	}
+	return fmt.Sprintf("<redacted, %d characters>", len([]rune(value)))
+}
+
+// inspectEntry decrypts the single password name of store and prints how
+// it is exported, for finding out why a password comes out unexpectedly.
+func inspectEntry(argv *argT, w io.Writer, store, name string) error {
+	name = strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(name), "/"), ".gpg")
+	path := filepath.Join(store, filepath.FromSlash(name)+".gpg")
+	fname := storeName(store, path)
+
+	out, status, err := runDecrypt(path, argv.passphrase)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, status.failureReason(err))
+	}
+	e, parseErr := buildEntry(argv, fname, out)
+	postProcess(argv, &summary{}, path, fname, &e)
+
+	show := argv.ShowSecrets
+	fmt.Fprintf(w, "folder:   %s\n", e.Folder)
+	fmt.Fprintf(w, "name:     %s\n", e.Name)
+	fmt.Fprintf(w, "type:     %s\n", e.Type)
+	fmt.Fprintf(w, "username: %s\n", e.LoginUsername)
+	fmt.Fprintf(w, "password: %s\n", redact(e.LoginPassword, show))
+	fmt.Fprintf(w, "uri:      %s\n", e.LoginURI)
+	fmt.Fprintf(w, "totp:     %s\n", redact(e.LoginTOTP, show))
+	fmt.Fprintf(w, "notes:    %s\n", redact(e.Notes, show))
+	fmt.Fprintf(w, "fields:\n")
+	for _, fl := range e.Fields {
+		fmt.Fprintf(w, "  %s: %s\n", fl.key, redact(fl.value, show))
+	}
+	for _, fl := range e.hidden {
+		fmt.Fprintf(w, "  %s (hidden): %s\n", fl.key, redact(fl.value, show))
+	}
+	if parseErr != nil {
+		fmt.Fprintf(w, "parse error: %s\n", parseErr)
+	}
+	return nil
+}
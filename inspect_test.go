@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInspectEntry(t *testing.T) {
+	fakeGPG(t, catGPG)
+	store := writeStore(t, map[string]string{
+		"web/shop": "hunter2\nlogin: me\nurl: https://shop.example.com\npin: 1234\naccount: 0042\n",
+	})
+	tests := []struct {
+		name, entry string
+		args        []string
+		want        string
+	}{
+		{"redacted", "web/shop", nil,
+			"folder:   web\n" +
+				"name:     shop\n" +
+				"type:     login\n" +
+				"username: me\n" +
+				"password: <redacted, 7 characters>\n" +
+				"uri:      https://shop.example.com\n" +
+				"totp:     \n" +
+				"notes:    <redacted, 10 characters>\n" +
+				"fields:\n" +
+				"  account: <redacted, 4 characters>\n"},
+		{"secrets shown", "/web/shop.gpg", []string{"--show-secrets"},
+			"folder:   web\n" +
+				"name:     shop\n" +
+				"type:     login\n" +
+				"username: me\n" +
+				"password: hunter2\n" +
+				"uri:      https://shop.example.com\n" +
+				"totp:     \n" +
+				"notes:    PIN: 1234\n" +
+				"\n" +
+				"fields:\n" +
+				"  account: 0042\n"},
+		{"hidden fields", "web/shop", []string{"--show-secrets", "--format", "enpass"},
+			"folder:   web\n" +
+				"name:     shop\n" +
+				"type:     login\n" +
+				"username: me\n" +
+				"password: hunter2\n" +
+				"uri:      https://shop.example.com\n" +
+				"totp:     \n" +
+				"notes:    \n" +
+				"fields:\n" +
+				"  account: 0042\n" +
+				"  pin (hidden): 1234\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := inspectEntry(parseArgv(t, tt.args...), &out, store, tt.entry); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectMissingEntry(t *testing.T) {
+	fakeGPG(t, `echo "gpg: can't open" >&2; exit 2`)
+	if err := inspectEntry(parseArgv(t), &bytes.Buffer{}, t.TempDir(), "nope"); err == nil {
+		t.Error("got no error for a missing password")
+	}
+}
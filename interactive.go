@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+// selection is the state of the interactive entry list, kept apart from the
+// prompt so it does not depend on a terminal.
+type selection struct {
+	items    []string
+	selected map[int]bool
+	filter   string
+}
+
+func newSelection(items []string) *selection {
+	return &selection{items: items, selected: make(map[int]bool)}
+}
+
+// visible returns the indexes of the items matching the current filter.
+func (s *selection) visible() []int {
+	var idx []int
+	filter := strings.ToLower(s.filter)
+	for i, item := range s.items {
+		if strings.Contains(strings.ToLower(item), filter) {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// toggle flips the nth visible item, counting from 1.
+func (s *selection) toggle(n int) error {
+	visible := s.visible()
+	if n < 1 || n > len(visible) {
+		return fmt.Errorf("no entry %d", n)
+	}
+	i := visible[n-1]
+	s.selected[i] = !s.selected[i]
+	return nil
+}
+
+// setVisible selects or deselects all visible items.
+func (s *selection) setVisible(selected bool) {
+	for _, i := range s.visible() {
+		s.selected[i] = selected
+	}
+}
+
+// chosen returns the selected items in list order.
+func (s *selection) chosen() []string {
+	var chosen []string
+	for i, item := range s.items {
+		if s.selected[i] {
+			chosen = append(chosen, item)
+		}
+	}
+	return chosen
+}
+
+// apply runs a single prompt command and reports whether the selection is
+// complete.
+func (s *selection) apply(cmd string) (bool, error) {
+	switch {
+	case cmd == "":
+		return true, nil
+	case strings.HasPrefix(cmd, "/"):
+		s.filter = cmd[1:]
+	case cmd == "a":
+		s.setVisible(true)
+	case cmd == "n":
+		s.setVisible(false)
+	default:
+		for _, arg := range strings.Fields(cmd) {
+			from, to := arg, arg
+			if parts := strings.SplitN(arg, "-", 2); len(parts) == 2 {
+				from, to = parts[0], parts[1]
+			}
+			start, err1 := strconv.Atoi(from)
+			end, err2 := strconv.Atoi(to)
+			if err1 != nil || err2 != nil {
+				return false, fmt.Errorf("unknown command %q", arg)
+			}
+			for n := start; n <= end; n++ {
+				if err := s.toggle(n); err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s *selection) render(w io.Writer) {
+	for n, i := range s.visible() {
+		mark := " "
+		if s.selected[i] {
+			mark = "x"
+		}
+		fmt.Fprintf(w, "[%s] %3d %s\n", mark, n+1, s.items[i])
+	}
+	fmt.Fprintf(w, "%d of %d entries selected", len(s.chosen()), len(s.items))
+	if s.filter != "" {
+		fmt.Fprintf(w, ", filtered by %q", s.filter)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprint(w, "Toggle numbers or ranges (1 3 5-7), /text to filter, a/n to select all/none shown, q to quit, enter to export: ")
+}
+
+// selectEntries lets the user pick the entries to export from the store at
+// root, without decrypting anything. It returns nil, meaning every entry, if
+// stdin is not a terminal.
+func selectEntries(root string, strict bool) ([]string, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		fmt.Fprintln(os.Stderr, "Not running in a terminal, exporting all entries")
+		return nil, nil
+	}
+
+	items, err := storeEntries(root, strict)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSelection(items)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		s.render(os.Stderr)
+		if !scanner.Scan() {
+			return nil, errCancelled
+		}
+		cmd := strings.TrimSpace(scanner.Text())
+		if cmd == "q" {
+			return nil, errCancelled
+		}
+		finished, err := s.apply(cmd)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if finished {
+			if len(s.chosen()) == 0 {
+				return nil, errors.New("no entries selected")
+			}
+			return s.chosen(), nil
+		}
+	}
+}
+
+// storeEntries returns the store paths of the password files below root,
+// walking the store like walkFiles.
+func storeEntries(root string, strict bool) ([]string, error) {
+	var items []string
+	err := walkStore(root, skipUnreadable(root, strict, nil, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if isPasswordFile(path, info) {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			items = append(items, strings.TrimSuffix(rel, ".gpg"))
+		}
+		return nil
+	}))
+	return items, err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelection(t *testing.T) {
+	items := []string{"mail/alice", "mail/bob", "web/shop", "web/forum", "bank"}
+	tests := []struct {
+		name     string
+		commands []string
+		want     []string
+		wantErr  bool
+	}{
+		{"nothing", nil, nil, false},
+		{"toggle", []string{"1 3"}, []string{"mail/alice", "web/shop"}, false},
+		{"toggle twice", []string{"1", "1"}, nil, false},
+		{"range", []string{"2-4"}, []string{"mail/bob", "web/shop", "web/forum"}, false},
+		{"filter numbers the matches", []string{"/WEB", "2"}, []string{"web/forum"}, false},
+		{"all shown", []string{"/mail", "a"}, []string{"mail/alice", "mail/bob"}, false},
+		{"none shown keeps hidden", []string{"a", "/web", "n"}, []string{"mail/alice", "mail/bob", "bank"}, false},
+		{"out of range", []string{"6"}, nil, true},
+		{"unknown command", []string{"x"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSelection(items)
+			var err error
+			for _, cmd := range tt.commands {
+				var done bool
+				if done, err = s.apply(cmd); done || err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want one: %v", err, tt.wantErr)
+			}
+			if got := s.chosen(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectionDone(t *testing.T) {
+	s := newSelection([]string{"a"})
+	if done, err := s.apply(""); !done || err != nil {
+		t.Errorf("enter: got %v, %v, want the selection complete", done, err)
+	}
+}
+
+func TestSelectionRender(t *testing.T) {
+	s := newSelection([]string{"mail/alice", "web/shop", "web/forum"})
+	s.apply("/web")
+	s.apply("2")
+	var out bytes.Buffer
+	s.render(&out)
+	want := "[ ]   1 web/shop\n[x]   2 web/forum\n1 of 3 entries selected, filtered by \"web\"\n"
+	if got := out.String(); !strings.HasPrefix(got, want) {
+		t.Errorf("got %q, want it to start with %q", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+)
+
+// kdbxGroup builds the group tree before it is copied into the database,
+// which holds groups by value.
+type kdbxGroup struct {
+	name    string
+	entries []gokeepasslib.Entry
+	groups  []*kdbxGroup
+	byName  map[string]*kdbxGroup
+}
+
+func (g *kdbxGroup) child(name string) *kdbxGroup {
+	if c, ok := g.byName[name]; ok {
+		return c
+	}
+	c := &kdbxGroup{name: name, byName: map[string]*kdbxGroup{}}
+	g.byName[name] = c
+	g.groups = append(g.groups, c)
+	return c
+}
+
+func (g *kdbxGroup) build() gokeepasslib.Group {
+	group := gokeepasslib.NewGroup()
+	group.Name = g.name
+	group.Entries = g.entries
+	for _, c := range g.groups {
+		group.Groups = append(group.Groups, c.build())
+	}
+	return group
+}
+
+func kdbxValue(key, value string, protected bool) gokeepasslib.ValueData {
+	v := gokeepasslib.ValueData{Key: key, Value: gokeepasslib.V{Content: value}}
+	if protected {
+		v.Value.Protected = w.NewBoolWrapper(true)
+	}
+	return v
+}
+
+// kdbxEntryFor maps e to a KeePass entry. Additional URLs and custom fields
+// become string fields, hidden fields protected ones and the TOTP secret the
+// otp field KeePassXC reads.
+func kdbxEntryFor(e *entry) gokeepasslib.Entry {
+	ke := gokeepasslib.NewEntry()
+	urls := strings.Split(e.LoginURI, ",")
+	ke.Values = append(ke.Values,
+		kdbxValue("Title", e.Name, false),
+		kdbxValue("UserName", e.LoginUsername, false),
+		kdbxValue("Password", e.LoginPassword, true),
+		kdbxValue("URL", urls[0], false),
+		kdbxValue("Notes", e.Notes, false),
+	)
+	for i, url := range urls[1:] {
+		ke.Values = append(ke.Values, kdbxValue(fmt.Sprintf("URL %d", i+2), url, false))
+	}
+	if e.LoginTOTP != "" {
+		ke.Values = append(ke.Values, kdbxValue("otp", e.LoginTOTP, true))
+	}
+	for _, fl := range e.Fields {
+		key := fl.key
+		if ke.Get(key) != nil {
+			key = "field " + key
+		}
+		ke.Values = append(ke.Values, kdbxValue(key, fl.value, false))
+	}
+	for _, fl := range e.hidden {
+		key := fl.key
+		if ke.Get(key) != nil {
+			key = "field " + key
+		}
+		ke.Values = append(ke.Values, kdbxValue(key, fl.value, true))
+	}
+	return ke
+}
+
+// kdbxWriter returns a writer of a KeePass database protected by password,
+// with a group for every folder. The database is written once every entry
+// has been read.
+func kdbxWriter(password string) func(io.Writer, <-chan *entry) error {
+	return func(out io.Writer, entries <-chan *entry) error {
+		root := &kdbxGroup{name: "pass", byName: map[string]*kdbxGroup{}}
+		for e := range entries {
+			g := root
+			for _, name := range strings.Split(folderName(e), "/") {
+				if name != "" {
+					g = g.child(name)
+				}
+			}
+			g.entries = append(g.entries, kdbxEntryFor(e))
+		}
+
+		db := &gokeepasslib.Database{
+			Header:      gokeepasslib.NewHeader(),
+			Credentials: gokeepasslib.NewPasswordCredentials(password),
+			Content: &gokeepasslib.DBContent{
+				Meta: gokeepasslib.NewMetaData(),
+				Root: &gokeepasslib.RootData{Groups: []gokeepasslib.Group{root.build()}},
+			},
+		}
+		if err := db.LockProtectedEntries(); err != nil {
+			return err
+		}
+		return gokeepasslib.NewEncoder(out).Encode(db)
+	}
+}
+
+// writeKDBXUnset is the kdbx writer of the format list, export replaces it
+// with a kdbxWriter for --kdbx-password.
+func writeKDBXUnset(io.Writer, <-chan *entry) error {
+	return errors.New("the kdbx format needs --kdbx-password")
+}
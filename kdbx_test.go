@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/tobischo/gokeepasslib/v3"
+)
+
+// openKDBX decodes the database in data with password.
+func openKDBX(t *testing.T, data []byte, password string) (*gokeepasslib.Database, error) {
+	t.Helper()
+	db := gokeepasslib.NewDatabase()
+	db.Credentials = gokeepasslib.NewPasswordCredentials(password)
+	if err := gokeepasslib.NewDecoder(bytes.NewReader(data)).Decode(db); err != nil {
+		return nil, err
+	}
+	return db, db.UnlockProtectedEntries()
+}
+
+// kdbxTitles returns group path/title of every entry below g.
+func kdbxTitles(g gokeepasslib.Group, path string) []string {
+	path += g.Name + "/"
+	var titles []string
+	for _, e := range g.Entries {
+		titles = append(titles, path+e.GetTitle())
+	}
+	for _, c := range g.Groups {
+		titles = append(titles, kdbxTitles(c, path)...)
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+func TestKDBX(t *testing.T) {
+	var out bytes.Buffer
+	err := kdbxWriter("s3cret")(&out, entryChan(
+		&entry{Folder: "/", Name: "mail", LoginPassword: "pw"},
+		&entry{Folder: "web", Name: "shop", LoginUsername: "me", LoginPassword: "hunter2",
+			LoginURI: "https://a.example,https://b.example", LoginTOTP: "otpauth://totp/shop?secret=JBSWY3DPEHPK3PXP",
+			Notes: "some notes\n", Fields: fieldList{{"account", "0042"}, {"URL", "clash"}}, hidden: fieldList{{"pin", "1234"}}},
+		&entry{Folder: "web/social", Name: "forum", LoginPassword: "pw"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := openKDBX(t, out.Bytes(), "wrong"); err == nil {
+		t.Error("opened the database with a wrong password")
+	}
+	db, err := openKDBX(t, out.Bytes(), "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := db.Content.Root.Groups
+	if len(groups) != 1 {
+		t.Fatalf("got %d root groups, want 1", len(groups))
+	}
+	want := []string{"pass/mail", "pass/web/shop", "pass/web/social/forum"}
+	if got := kdbxTitles(groups[0], ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %q, want %q", got, want)
+	}
+
+	shop := groups[0].Groups[0].Entries[0]
+	values := map[string]string{}
+	protected := map[string]bool{}
+	for _, v := range shop.Values {
+		values[v.Key] = v.Value.Content
+		protected[v.Key] = v.Value.Protected.Bool
+	}
+	wantValues := map[string]string{
+		"Title": "shop", "UserName": "me", "Password": "hunter2", "URL": "https://a.example",
+		"URL 2": "https://b.example", "Notes": "some notes\n", "otp": "otpauth://totp/shop?secret=JBSWY3DPEHPK3PXP",
+		"account": "0042", "field URL": "clash", "pin": "1234",
+	}
+	if !reflect.DeepEqual(values, wantValues) {
+		t.Errorf("got values %q, want %q", values, wantValues)
+	}
+	for key, want := range map[string]bool{"Password": true, "otp": true, "pin": true, "UserName": false, "account": false} {
+		if protected[key] != want {
+			t.Errorf("%s protected: %v, want %v", key, protected[key], want)
+		}
+	}
+}
+
+func TestKDBXExport(t *testing.T) {
+	files := map[string]string{"mail": "pw\n", "web/shop": "pw\n"}
+	if _, err := exportStore(t, files, "--format", "kdbx"); err == nil {
+		t.Error("got no error without --kdbx-password")
+	}
+	out, err := exportStore(t, files, "--format", "kdbx", "--kdbx-password", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openKDBX(t, []byte(out), "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"pass/mail", "pass/web/shop"}
+	if got := kdbxTitles(db.Content.Root.Groups[0], ""); !reflect.DeepEqual(got, want) {
+		t.Errorf("got entries %q, want %q", got, want)
+	}
+}
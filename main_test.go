@@ -0,0 +1,1577 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mkideal/cli"
+)
+
+// parseArgv returns the flags args parse to, with the defaults of argT.
+func parseArgv(t *testing.T, args ...string) *argT {
+	t.Helper()
+	argv := new(argT)
+	if err := cli.Parse(args, argv); err != nil {
+		t.Fatalf("parsing %q: %v", args, err)
+	}
+	return argv
+}
+
+// runArgs calls run with the command line args and returns its error.
+func runArgs(args ...string) error {
+	var err error
+	cli.RunWithArgs(new(argT), append([]string{"pass2bitwarden"}, args...), func(ctx *cli.Context) error {
+		err = run(ctx)
+		return err
+	})
+	return err
+}
+
+// runCode calls run like main and returns the exit code of the process.
+func runCode(args ...string) int {
+	var err error
+	code := cli.RunWithArgs(new(argT), append([]string{"pass2bitwarden"}, args...), func(ctx *cli.Context) error {
+		err = run(ctx)
+		return err
+	})
+	return exitCode(code, err)
+}
+
+// fakeGPG puts gpg and gpg2 commands running script first on the PATH.
+func fakeGPG(t *testing.T, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"gpg", "gpg2"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// catGPG decrypts by printing the file, the password files of tests are
+// plain text.
+const catGPG = `for last; do :; done; cat "$last"`
+
+// writeStore creates a password store with the given store paths and
+// contents and returns its directory.
+func writeStore(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name)+".gpg")
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// processEntry builds the entry of the password file fname with content
+// and applies postProcess to it, like decrypt does.
+func processEntry(t *testing.T, argv *argT, fname, content string) entry {
+	t.Helper()
+	e, err := buildEntry(argv, fname, []byte(content))
+	if err != nil {
+		t.Fatalf("building %s: %v", fname, err)
+	}
+	postProcess(argv, &summary{}, filepath.Join(t.TempDir(), fname), fname, &e)
+	return e
+}
+
+func TestDebugDumpDirNeedsConfirmation(t *testing.T) {
+	err := runArgs("--debug-dump-dir", t.TempDir(), "--no-unlock", "--password-store", t.TempDir())
+	if !errors.Is(err, errUsage) {
+		t.Fatalf("got %v, want %v", err, errUsage)
+	}
+}
+
+func TestDumpRaw(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dump")
+	content := []byte("pw\nnot: valid: yaml\n")
+	if err := dumpRaw(dir, "/web/site.gpg", content); err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got %d files, want 1", len(files))
+	}
+	path := filepath.Join(dir, files[0].Name())
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("got %q, want %q", got, content)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("got mode %v, want 0600", perm)
+	}
+}
+
+func TestBuildEntryDuplicateKeys(t *testing.T) {
+	argv := parseArgv(t)
+	content := "pw\nurl: https://a.example\nurl: https://b.example\nfoo: 1\nfoo: 2\n"
+	e, err := buildEntry(argv, "/dup.gpg", []byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://a.example,https://b.example"; e.LoginURI != want {
+		t.Errorf("got uri %q, want %q", e.LoginURI, want)
+	}
+	if want := (fieldList{{"foo", "1"}, {"foo_2", "2"}}); !reflect.DeepEqual(e.Fields, want) {
+		t.Errorf("got fields %v, want %v", e.Fields, want)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		gpg    string
+		files  map[string]string
+		unlock bool
+		args   []string
+		want   int
+	}{
+		{"success", catGPG, map[string]string{"a": "pw\n"}, false, nil, 0},
+		{"error", catGPG, map[string]string{}, false, []string{"--refuse-empty"}, 1},
+		{"usage", catGPG, map[string]string{"a": "pw\n"}, false, []string{"--sort", "size"}, 2},
+		{"unknown flag", catGPG, map[string]string{"a": "pw\n"}, false, []string{"--no-such-flag"}, 2},
+		{"unlock", "exit 2", map[string]string{"a": "pw\n"}, true, nil, 3},
+		{"partial", `for last; do :; done; case "$last" in *bad.gpg) exit 2;; esac; cat "$last"`,
+			map[string]string{"a": "pw\n", "bad": "pw\n"}, false, nil, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeGPG(t, tt.gpg)
+			store := writeStore(t, tt.files)
+			args := []string{"--password-store", store, "-o", filepath.Join(t.TempDir(), "out.csv")}
+			if !tt.unlock {
+				args = append(args, "--no-unlock")
+			}
+			if got := runCode(append(args, tt.args...)...); got != tt.want {
+				t.Errorf("got exit code %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExitCodeCancelled(t *testing.T) {
+	started := filepath.Join(t.TempDir(), "started")
+	fakeGPG(t, "touch "+started+"; sleep 1")
+	store := writeStore(t, map[string]string{"a": "pw\n"})
+	go func() {
+		// the export listens for signals once gpg runs
+		for {
+			if _, err := os.Stat(started); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	got := runCode("--no-unlock", "--password-store", store, "-o", filepath.Join(t.TempDir(), "out.csv"))
+	if got != 5 {
+		t.Errorf("got exit code %d, want 5", got)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, 2},
+		{errors.New("boom"), 1},
+		{fmt.Errorf("%w: bad flag", errUsage), 2},
+		{fmt.Errorf("%w: no key", errUnlock), 3},
+		{fmt.Errorf("%w (3)", errPartial), 4},
+		{errCancelled, 5},
+		{coloredError{errPartial}, 4},
+	}
+	for _, tt := range tests {
+		if got := exitCode(1, tt.err); got != tt.want {
+			t.Errorf("exitCode(1, %v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+	if got := exitCode(0, nil); got != 0 {
+		t.Errorf("exitCode(0, nil) = %d, want 0", got)
+	}
+}
+
+func TestAttachmentNamesDoNotCollide(t *testing.T) {
+	dir := t.TempDir()
+	first, err := attachmentEntry(dir, "/a/b.gpg", []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := attachmentEntry(dir, "/a_b.gpg", []byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Notes == second.Notes {
+		t.Fatalf("both attachments reference the same file: %s", first.Notes)
+	}
+	for _, tt := range []struct {
+		e    entry
+		want string
+	}{{first, "first"}, {second, "second"}} {
+		file := strings.TrimPrefix(strings.SplitN(tt.e.Notes, " (", 2)[0], "Attachment: ")
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s holds %q, want %q", file, got, tt.want)
+		}
+	}
+}
+
+func TestDumpRawNamesDoNotCollide(t *testing.T) {
+	dir := t.TempDir()
+	for _, fname := range []string{"/a/b.gpg", "/a_b.gpg"} {
+		if err := dumpRaw(dir, fname, []byte(fname)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d dumps, want 2", len(files))
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		content      string
+		wantUsername string
+		wantNotes    string
+		wantFields   fieldList
+	}{
+		{"username and email", nil, "pw\nusername: bob\nemail: bob@example.com\n",
+			"bob", "", fieldList{{"email", "bob@example.com"}}},
+		{"email to notes", []string{"--extra-email", "notes"}, "pw\nusername: bob\nemail: bob@example.com\n",
+			"bob", "Email: bob@example.com\n", nil},
+		{"email dropped", []string{"--extra-email", "drop"}, "pw\nusername: bob\nemail: bob@example.com\n",
+			"bob", "", nil},
+		{"email only", nil, "pw\nemail: bob@example.com\n",
+			"", "", fieldList{{"email", "bob@example.com"}}},
+		{"email as username", []string{"--email-as-username"}, "pw\nemail: bob@example.com\n",
+			"bob@example.com", "", nil},
+		{"email as username with username", []string{"--email-as-username"}, "pw\nlogin: bob\nemail: bob@example.com\n",
+			"bob", "", fieldList{{"email", "bob@example.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, tt.args...), "/site.gpg", tt.content)
+			if e.LoginUsername != tt.wantUsername {
+				t.Errorf("got username %q, want %q", e.LoginUsername, tt.wantUsername)
+			}
+			if e.Notes != tt.wantNotes {
+				t.Errorf("got notes %q, want %q", e.Notes, tt.wantNotes)
+			}
+			if len(e.Fields) != 0 || len(tt.wantFields) != 0 {
+				if !reflect.DeepEqual(e.Fields, tt.wantFields) {
+					t.Errorf("got fields %v, want %v", e.Fields, tt.wantFields)
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordLine(t *testing.T) {
+	tests := []struct {
+		name         string
+		line         string
+		content      string
+		wantPassword string
+		wantNotes    string
+		wantFields   fieldList
+	}{
+		{"first line", "1", "pw\nuser: bob\n", "pw", "", fieldList{{"user", "bob"}}},
+		{"second line", "2", "My Bank\npw\nuser: bob\n", "pw", "My Bank\n", fieldList{{"user", "bob"}}},
+		{"out of range", "9", "pw\nuser: bob\n", "pw", "", fieldList{{"user", "bob"}}},
+		{"past the final newline", "2", "onlyline\n", "onlyline", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := buildEntry(parseArgv(t, "--password-line", tt.line), "/bank.gpg", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.LoginPassword != tt.wantPassword || e.Notes != tt.wantNotes || !reflect.DeepEqual(e.Fields, tt.wantFields) {
+				t.Errorf("got password %q, notes %q, fields %v, want %q, %q, %v",
+					e.LoginPassword, e.Notes, e.Fields, tt.wantPassword, tt.wantNotes, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestPasswordLineValidated(t *testing.T) {
+	for _, line := range []string{"0", "-1"} {
+		if err := runArgs("--password-line="+line, "--no-unlock", "--password-store", t.TempDir()); !errors.Is(err, errUsage) {
+			t.Errorf("--password-line %s: got %v, want %v", line, err, errUsage)
+		}
+	}
+}
+
+func TestNoUnlock(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want bool
+	}{
+		{"default", nil, true},
+		{"no unlock", []string{"--no-unlock"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			defer func(old func() error) { unlock = old }(unlock)
+			unlock = func() error {
+				called = true
+				return nil
+			}
+			fakeGPG(t, catGPG)
+			args := append([]string{"--password-store", writeStore(t, nil), "-o", filepath.Join(t.TempDir(), "out.csv")}, tt.args...)
+			runArgs(args...)
+			if called != tt.want {
+				t.Errorf("unlock called: %v, want %v", called, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("site%d", i)] = "pw\n"
+	}
+	tests := []struct {
+		name      string
+		maxErrors string
+		want      int
+	}{
+		{"threshold", "3", 3},
+		{"no limit", "0", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := filepath.Join(t.TempDir(), "calls")
+			fakeGPG(t, fmt.Sprintf("echo >> %q; exit 2", calls))
+			err := runArgs("--no-unlock", "--max-errors", tt.maxErrors, "--password-store", writeStore(t, files),
+				"-o", filepath.Join(t.TempDir(), "out.csv"))
+			if err == nil {
+				t.Fatal("got no error")
+			}
+			if aborted := strings.Contains(err.Error(), "aborting"); aborted != (tt.maxErrors != "0") {
+				t.Errorf("got %v", err)
+			}
+			log, _ := os.ReadFile(calls)
+			if got := strings.Count(string(log), "\n"); got != tt.want {
+				t.Errorf("gpg called %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingWriter fails every write after the first n.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestExportStopsWhenWritingFails(t *testing.T) {
+	fakeGPG(t, catGPG)
+	files := map[string]string{}
+	for i := 0; i < 200; i++ {
+		files[fmt.Sprintf("site%03d", i)] = fmt.Sprintf("pw%d\nnote: %s\n", i, strings.Repeat("x", 100))
+	}
+	store := writeStore(t, files)
+	for _, n := range []int{0, 1, 3} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			argv := parseArgv(t, "--no-unlock", "--password-store", store)
+			done := make(chan error, 1)
+			go func() { done <- export(argv, &failingWriter{n: n}, nil) }()
+			select {
+			case err := <-done:
+				if err == nil || !strings.Contains(err.Error(), "disk full") {
+					t.Errorf("got %v, want the write error", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("export did not return after the write failed")
+			}
+		})
+	}
+}
+
+func TestSkipUnreadable(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		err         error
+		strict      bool
+		want        error
+		wantSkipped bool
+	}{
+		{"readable", "/store/web", nil, false, nil, false},
+		{"unreadable folder", "/store/web", fs.ErrPermission, false, filepath.SkipDir, true},
+		{"strict", "/store/web", fs.ErrPermission, true, fs.ErrPermission, false},
+		{"unreadable root", "/store", fs.ErrPermission, false, fs.ErrPermission, false},
+		{"other error", "/store/web", fs.ErrNotExist, false, fs.ErrNotExist, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skipped := false
+			walk := skipUnreadable("/store", tt.strict, func(string) { skipped = true }, func(path string, info os.FileInfo, err error) error {
+				return err
+			})
+			if got := walk(tt.path, nil, tt.err); got != tt.want || skipped != tt.wantSkipped {
+				t.Errorf("got %v and skipped %v, want %v and %v", got, skipped, tt.want, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestWalksAgreeOnUnreadableFolders(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read every folder")
+	}
+	store := writeStore(t, map[string]string{"a": "pw\n", "web": "pw\n", "web/b": "pw\n", "locked/c": "pw\n"})
+	locked := filepath.Join(store, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0700)
+
+	n, err := countFiles(store, false, time.Time{})
+	if err != nil || n != 3 {
+		t.Errorf("countFiles: got %d, %v, want 3", n, err)
+	}
+	collisions, err := findCollisions(store, false)
+	if err != nil || len(collisions) != 1 {
+		t.Errorf("findCollisions: got %v, %v, want web.gpg", collisions, err)
+	}
+	if _, err := countFiles(store, true, time.Time{}); err == nil {
+		t.Error("countFiles: got no error with strict")
+	}
+	if _, err := findCollisions(store, true); err == nil {
+		t.Error("findCollisions: got no error with strict")
+	}
+	paths, errc := walkFiles(make(chan struct{}), &summary{}, store, false, time.Time{}, 0)
+	sent := 0
+	for range paths {
+		sent++
+	}
+	if sent != n {
+		t.Errorf("walkFiles sent %d paths, countFiles counted %d", sent, n)
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("walkFiles: %v", err)
+	}
+
+	entries, err := storeEntries(store, false)
+	if err != nil || len(entries) != n {
+		t.Errorf("storeEntries: got %q, %v, want %d entries", entries, err, n)
+	}
+	if _, err := storeEntries(store, true); err == nil {
+		t.Error("storeEntries: got no error with strict")
+	}
+	if _, err := checkRecipients(store, nil, false); err != nil {
+		t.Errorf("checkRecipients: %v", err)
+	}
+	if _, err := checkRecipients(store, nil, true); err == nil {
+		t.Error("checkRecipients: got no error with strict")
+	}
+	for _, strict := range []bool{false, true} {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = watchDirs(watcher, store, strict)
+		watched := len(watcher.WatchList())
+		watcher.Close()
+		if strict && err == nil {
+			t.Error("watchDirs: got no error with strict")
+		}
+		if !strict && (err != nil || watched != 2) {
+			t.Errorf("watchDirs: got %d folders, %v, want the store and web", watched, err)
+		}
+	}
+}
+
+func TestModifiedAfter(t *testing.T) {
+	store := writeStore(t, map[string]string{"old": "pw\n", "web/old": "pw\n", "new": "pw\n", "web/new": "pw\n"})
+	now := time.Now()
+	for _, name := range []string{"old", "web/old"} {
+		past := now.Add(-48 * time.Hour)
+		if err := os.Chtimes(filepath.Join(store, name+".gpg"), past, past); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name  string
+		after time.Time
+		want  int
+	}{
+		{"all", time.Time{}, 4},
+		{"straddling", now.Add(-24 * time.Hour), 2},
+		{"none", now.Add(time.Hour), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum := &summary{}
+			paths, errc := walkFiles(make(chan struct{}), sum, store, false, tt.after, 0)
+			sent := 0
+			for path := range paths {
+				if strings.Contains(path, "old") && !tt.after.IsZero() {
+					t.Errorf("sent %s", path)
+				}
+				sent++
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			n, err := countFiles(store, false, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sent != tt.want || n != tt.want || sum.unmodified != 4-tt.want {
+				t.Errorf("sent %d, counted %d and dropped %d, want %d, %d and %d", sent, n, sum.unmodified, tt.want, tt.want, 4-tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPaths(t *testing.T) {
+	store := writeStore(t, map[string]string{"a": "pw\n", "web/b": "pw\n"})
+	if err := os.Mkdir(filepath.Join(store, "web", "dir.gpg"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	list := strings.Join([]string{
+		"a",
+		"  web/b.gpg  ",
+		"",
+		"missing",
+		"../outside",
+		"web/../../outside",
+		"web/dir",
+	}, "\n")
+	sum := &summary{}
+	paths, errc := readPaths(make(chan struct{}), sum, store, strings.NewReader(list))
+	var got []string
+	for path := range paths {
+		got = append(got, storeName(store, path))
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/a.gpg", "/web/b.gpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	var skipped []string
+	for _, f := range sum.failures {
+		skipped = append(skipped, f.Name+": "+f.Reason)
+	}
+	want := []string{
+		"missing.gpg: no such password",
+		"../outside.gpg: not inside the password store",
+		"web/../../outside.gpg: not inside the password store",
+		"web/dir.gpg: no such password",
+	}
+	if !reflect.DeepEqual(skipped, want) {
+		t.Errorf("got skipped %q, want %q", skipped, want)
+	}
+}
+
+// exportStore exports a store holding files with the extra args and returns
+// the written export and the error of run.
+func exportStore(t *testing.T, files map[string]string, args ...string) (string, error) {
+	t.Helper()
+	fakeGPG(t, catGPG)
+	out := filepath.Join(t.TempDir(), "out")
+	err := runArgs(append([]string{"--no-unlock", "--password-store", writeStore(t, files), "-o", out}, args...)...)
+	got, _ := os.ReadFile(out)
+	return string(got), err
+}
+
+func TestBinaryContent(t *testing.T) {
+	files := map[string]string{"text": "hunter2\n", "image": "\x89PNG\r\n\x1a\n\xff\xd8"}
+	tests := []struct {
+		name      string
+		args      []string
+		wantErr   error
+		wantImage bool
+	}{
+		{"skipped", nil, errPartial, false},
+		{"allowed", []string{"--allow-binary"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, files, tt.args...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(out, "hunter2") {
+				t.Errorf("text password missing from %q", out)
+			}
+			if got := strings.Contains(out, ",image,"); got != tt.wantImage {
+				t.Errorf("image exported: %v, want %v", got, tt.wantImage)
+			}
+		})
+	}
+}
+
+func TestAttachmentsDir(t *testing.T) {
+	image := "\x89PNG\r\n\x1a\n\xff\xd8"
+	large := strings.Repeat("x", 100) + "\n"
+	files := map[string]string{"text": "hunter2\n", "docs/image": image, "large": large}
+	dir := filepath.Join(t.TempDir(), "attachments")
+	out, err := exportStore(t, files, "--attachments-dir", dir, "--attachment-size", "64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for fname, content := range map[string]string{"docs_image": image, "large": large} {
+		path := filepath.Join(dir, fname)
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s holds %q, want %q", path, got, content)
+		}
+		if want := fmt.Sprintf("Attachment: %s (%d bytes)", path, len(content)); !strings.Contains(out, want) {
+			t.Errorf("export does not reference %s:\n%s", path, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "text")); err == nil {
+		t.Error("small text password written as attachment")
+	}
+}
+
+func TestCountFiles(t *testing.T) {
+	fakeGPG(t, catGPG)
+	store := writeStore(t, map[string]string{"a": "pw\n", "web/b": "pw\n", "web/deep/c": "pw\n", ".git/objects/d": "pw\n"})
+	for name, content := range map[string]string{".gpg-id": "alice@example.com\n", "web/readme.txt": "x\n"} {
+		if err := os.WriteFile(filepath.Join(store, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := countFiles(store, false, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, errc := parseStores(parseArgv(t, "--password-store", store), &summary{}, nil, make(chan struct{}), nil)
+	processed := len(collect(entries))
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || processed != n {
+		t.Errorf("counted %d and processed %d, want 3", n, processed)
+	}
+}
+
+func TestNoImplicitPassword(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		content      string
+		wantPassword string
+		wantFields   fieldList
+	}{
+		{"default", nil, "api_key: abc\nuser: svc\n", "api_key: abc", fieldList{{"user", "svc"}}},
+		{"no implicit password", []string{"--no-implicit-password"}, "api_key: abc\nuser: svc\n", "", fieldList{{"api_key", "abc"}, {"user", "svc"}}},
+		{"bare password kept", []string{"--no-implicit-password"}, "hunter2\nuser: svc\n", "hunter2", fieldList{{"user", "svc"}}},
+		{"labelled password", nil, "password: abc\nuser: svc\n", "abc", fieldList{{"user", "svc"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, tt.args...), "/api.gpg", tt.content)
+			if e.LoginPassword != tt.wantPassword || !reflect.DeepEqual(e.Fields, tt.wantFields) {
+				t.Errorf("got password %q and fields %v, want %q and %v", e.LoginPassword, e.Fields, tt.wantPassword, tt.wantFields)
+			}
+		})
+	}
+}
+
+// csvRows reads a Bitwarden CSV export into a record per entry, keyed by
+// the column names.
+func csvRows(t *testing.T, export string) []map[string]string {
+	t.Helper()
+	records, err := csv.NewReader(strings.NewReader(export)).ReadAll()
+	if err != nil {
+		t.Fatalf("reading %q: %v", export, err)
+	}
+	var rows []map[string]string
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// folderNames returns folder/name of every row of export, sorted.
+func folderNames(t *testing.T, export string) []string {
+	t.Helper()
+	var names []string
+	for _, row := range csvRows(t, export) {
+		names = append(names, row["folder"]+"|"+row["name"])
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestOnCollision(t *testing.T) {
+	files := map[string]string{"work": "pw\n", "work/github": "pw\n"}
+	tests := []struct {
+		mode    string
+		want    []string
+		wantErr bool
+	}{
+		{"keep", []string{"/|work", "work|github"}, false},
+		{"rename", []string{"work|github", "work|work"}, false},
+		{"suffix", []string{"/|work (entry)", "work|github"}, false},
+		{"error", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			out, err := exportStore(t, files, "--on-collision", tt.mode)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "work.gpg") {
+					t.Errorf("got %v, want an error naming work.gpg", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := folderNames(t, out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFullPathName(t *testing.T) {
+	tests := []struct {
+		fname, want string
+	}{
+		{"/work/github/personal.gpg", "work/github/personal"},
+		{"/root.gpg", "root"},
+		{filepath.FromSlash("/a/b/c.gpg"), "a/b/c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, "--full-path-name"), tt.fname, "pw\n")
+			if e.Name != tt.want || e.Folder != "" {
+				t.Errorf("got folder %q and name %q, want no folder and %q", e.Folder, e.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorePrefix(t *testing.T) {
+	fakeGPG(t, catGPG)
+	personal := writeStore(t, map[string]string{"mail": "pw\n", "shop/amazon": "pw\n"})
+	work := writeStore(t, map[string]string{"mail": "pw\n", "ci/jenkins": "pw\n"})
+	tests := []struct {
+		name     string
+		prefixes []string
+		want     []string
+	}{
+		{"prefixes", []string{"personal", "work/"}, []string{
+			"personal/shop|amazon", "personal|mail", "work/ci|jenkins", "work|mail",
+		}},
+		{"first store only", []string{"personal"}, []string{
+			"/|mail", "ci|jenkins", "personal/shop|amazon", "personal|mail",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out")
+			args := []string{"--no-unlock", "--password-store", personal, "--password-store", work, "-o", out}
+			for _, prefix := range tt.prefixes {
+				args = append(args, "--store-prefix", prefix)
+			}
+			if err := runArgs(args...); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(out)
+			if names := folderNames(t, string(got)); !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("got %q, want %q", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepEmpty(t *testing.T) {
+	// the binary password is not text and skipped either way
+	files := map[string]string{
+		"text":   "hunter2\n",
+		"empty":  "",
+		"blank":  "\n\n\n",
+		"binary": "\x89PNG\r\n\x1a\n\xff\xd8",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"skipped", nil, []string{"/|text"}},
+		{"kept", []string{"--keep-empty"}, []string{"/|blank", "/|empty", "/|text"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, files, tt.args...)
+			if !errors.Is(err, errPartial) {
+				t.Errorf("got %v, want %v", err, errPartial)
+			}
+			if got := folderNames(t, out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	t.Run("counted", func(t *testing.T) {
+		fakeGPG(t, catGPG)
+		root := writeStore(t, files)
+		paths := make(chan string, len(files))
+		for name := range files {
+			paths <- filepath.Join(root, name+".gpg")
+		}
+		close(paths)
+		sum := &summary{}
+		results := make(chan *entry, len(files))
+		if err := decrypt(parseArgv(t), sum, nil, root, nil, paths, results); err != nil {
+			t.Fatal(err)
+		}
+		if n := sum.emptyCount(); n != 2 {
+			t.Errorf("got %d empty passwords, want 2", n)
+		}
+	})
+}
+
+func TestStamp(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "v1.2.3"
+	files := map[string]string{"bare": "pw\n", "notes": "pw\nsome notes\n", "fields": "pw\nuser: me\n"}
+	tests := []struct {
+		name  string
+		args  []string
+		count int
+	}{
+		{"off", nil, 0},
+		{"on", []string{"--stamp"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, files, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stamp := "exported-by: pass2bitwarden v1.2.3 on " + time.Now().Format("2006-01-02") + "\n"
+			for _, row := range csvRows(t, out) {
+				if n := strings.Count(row["notes"], "exported-by:"); n != tt.count {
+					t.Errorf("%s: %d stamps in %q, want %d", row["name"], n, row["notes"], tt.count)
+				}
+				if tt.count > 0 && !strings.HasSuffix(row["notes"], stamp) {
+					t.Errorf("%s: notes %q do not end with %q", row["name"], row["notes"], stamp)
+				}
+			}
+		})
+	}
+}
+
+func TestSSHKey(t *testing.T) {
+	key, err := os.ReadFile(filepath.Join("testdata", "ssh-key.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name, content string
+	}{
+		{"key only", string(key)},
+		{"key after a passphrase", "correct horse\ncomment: deploy key\n" + string(key)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, map[string]string{"ssh/id_ed25519": tt.content})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows := csvRows(t, out)
+			if len(rows) != 1 {
+				t.Fatalf("got %d rows, want 1", len(rows))
+			}
+			row := rows[0]
+			if row["type"] != "note" || row["notes"] != tt.content {
+				t.Errorf("got type %q and notes %q, want a note keeping %q", row["type"], row["notes"], tt.content)
+			}
+			if row["login_password"] != "" || row["fields"] != "" {
+				t.Errorf("got password %q and fields %q, want none", row["login_password"], row["fields"])
+			}
+		})
+	}
+}
+
+func TestNumericFieldsKeepTheirText(t *testing.T) {
+	tests := []struct {
+		name, value string
+	}{
+		{"leading zeros", "0012345678"},
+		{"large integer", "123456789012345678901234567890"},
+		{"octal looking", "0755"},
+		{"float", "1.50"},
+		{"exponent", "1e3"},
+		{"hex", "0x1F"},
+		{"boolean", "yes"},
+		{"null", "~"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, map[string]string{"bank": "pw\naccount: " + tt.value + "\n"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows := csvRows(t, out)
+			if want := "account: " + tt.value + "\n"; len(rows) != 1 || rows[0]["fields"] != want {
+				t.Errorf("got %v, want fields %q", rows, want)
+			}
+		})
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	fakeGPG(t, `for last; do :; done
+case "$last" in *broken*) echo "decryption failed" >&2; exit 2;; esac
+cat "$last"`)
+	store := writeStore(t, map[string]string{
+		"login":  "pw\n",
+		"note":   "\nfree text\n",
+		"empty":  "",
+		"broken": "pw\n",
+		"image":  "\x89PNG\r\n\x1a\n\xff\xd8",
+	})
+	path := filepath.Join(t.TempDir(), "report.json")
+	err := runArgs("--no-unlock", "--password-store", store, "-o", filepath.Join(t.TempDir(), "out"), "--report-json", path)
+	if !errors.Is(err, errPartial) {
+		t.Fatalf("got %v, want %v", err, errPartial)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got report
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 5 || got.Exported != 2 || got.Skipped != 2 || got.Empty != 1 {
+		t.Errorf("got total %d, exported %d, skipped %d and empty %d, want 5, 2, 2 and 1", got.Total, got.Exported, got.Skipped, got.Empty)
+	}
+	if want := map[string]int{"login": 1, "note": 1}; !reflect.DeepEqual(got.ByType, want) {
+		t.Errorf("got by type %v, want %v", got.ByType, want)
+	}
+	var failed []string
+	for _, f := range got.Failed {
+		if f.Reason == "" {
+			t.Errorf("%s failed without a reason", f.Name)
+		}
+		failed = append(failed, f.Name)
+	}
+	sort.Strings(failed)
+	if want := []string{"/broken.gpg", "/image.gpg"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("got failures %q, want %q", failed, want)
+	}
+	if !strings.Contains(got.Error, errPartial.Error()) {
+		t.Errorf("got error %q, want it to mention %q", got.Error, errPartial)
+	}
+}
+
+func TestPassOTPLayouts(t *testing.T) {
+	const uri = "otpauth://totp/shop:me?secret=JBSWY3DPEHPK3PXP&issuer=shop"
+	tests := []struct {
+		name, content string
+		args          []string
+		wantTOTP      string
+		wantPassword  string
+		wantFields    fieldList
+		wantNotes     string
+	}{
+		{"otp insert", uri + "\n", nil, uri, "", fieldList{}, ""},
+		{"append", "pw\n" + uri + "\n", nil, uri, "pw", fieldList{}, ""},
+		{"same line", "pw " + uri + "\n", nil, uri, "pw", fieldList{}, ""},
+		{"after fields", "pw\nuser: me\n" + uri + "\n", nil, uri, "pw", fieldList{{"user", "me"}}, ""},
+		{"between notes", "pw\nuser: me\nsome notes\n" + uri + "\nmore notes\n", []string{"--strict-fields"},
+			uri, "pw", fieldList{{"user", "me"}}, "some notes\nmore notes\n"},
+		{"trailing space", "pw\n" + uri + "  \n", nil, uri, "pw", fieldList{}, ""},
+		{"otpauth field", "pw\notpauth: " + uri + "\n", nil, uri, "pw", fieldList{}, ""},
+		{"bare otp field", "pw\notp: JBSWY3DPEHPK3PXP\n", nil, "JBSWY3DPEHPK3PXP", "pw", fieldList{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := buildEntry(parseArgv(t, tt.args...), "/shop.gpg", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.LoginTOTP != tt.wantTOTP {
+				t.Errorf("got TOTP %q, want %q", e.LoginTOTP, tt.wantTOTP)
+			}
+			if e.LoginPassword != tt.wantPassword || !reflect.DeepEqual(e.Fields, tt.wantFields) || e.Notes != tt.wantNotes {
+				t.Errorf("got password %q, fields %v and notes %q, want %q, %v and %q",
+					e.LoginPassword, e.Fields, e.Notes, tt.wantPassword, tt.wantFields, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestBlankPasswordNote(t *testing.T) {
+	tests := []struct {
+		name, content string
+		wantType      string
+		wantNotes     string
+		wantFields    fieldList
+	}{
+		{"free text", "\nWiFi at home\nask the neighbours: they know\n", "note", "WiFi at home\nask the neighbours: they know\n", nil},
+		{"several blank lines", "\n\n\nsome text\n\n", "note", "some text\n", nil},
+		{"fields", "\nuser: me\n", "login", "", fieldList{{"user", "me"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := buildEntry(parseArgv(t), "/wifi.gpg", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Type != tt.wantType || e.Notes != tt.wantNotes || e.LoginPassword != "" || !reflect.DeepEqual(e.Fields, tt.wantFields) {
+				t.Errorf("got type %q, notes %q, password %q and fields %v, want a %s with notes %q and fields %v",
+					e.Type, e.Notes, e.LoginPassword, e.Fields, tt.wantType, tt.wantNotes, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestSortFields(t *testing.T) {
+	files := map[string]string{"shop": "pw\nzone: eu\nAccount: 42\nbeta: yes\naccount: 7\n"}
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"as written", nil, "zone: eu\nAccount: 42\nbeta: yes\naccount: 7\n"},
+		{"by key", []string{"--sort-fields"}, "Account: 42\naccount: 7\nbeta: yes\nzone: eu\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, files, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows := csvRows(t, out); len(rows) != 1 || rows[0]["fields"] != tt.want {
+				t.Errorf("got %v, want fields %q", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrictFields(t *testing.T) {
+	const content = "pw\nlogin: me\nurl: https://example.com\n\nBought in 2019. Note: the support\nline is 0800 123.\nexpires: never\n"
+	tests := []struct {
+		name       string
+		args       []string
+		wantFields fieldList
+		wantNotes  string
+		wantErr    bool
+	}{
+		{"default", nil, nil, "", true},
+		{"strict", []string{"--strict-fields"}, fieldList{}, "Bought in 2019. Note: the support\nline is 0800 123.\nexpires: never\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := buildEntry(parseArgv(t, tt.args...), "/shop.gpg", []byte(content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if e.LoginUsername != "me" || e.LoginURI != "https://example.com" {
+				t.Errorf("got username %q and uri %q, want me and https://example.com", e.LoginUsername, e.LoginURI)
+			}
+			if !reflect.DeepEqual(e.Fields, tt.wantFields) || e.Notes != tt.wantNotes {
+				t.Errorf("got fields %v and notes %q, want %v and %q", e.Fields, e.Notes, tt.wantFields, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestPasswordField(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		content      string
+		wantPassword string
+		wantFields   fieldList
+	}{
+		{"labelled first line", nil, "password: hunter2\nlogin: me\n", "hunter2", fieldList{}},
+		{"pass alias", nil, "pass: hunter2\n", "hunter2", fieldList{}},
+		{"case-insensitive", nil, "Password: hunter2\n", "hunter2", fieldList{}},
+		{"blank first line", nil, "\nlogin: me\npassword: hunter2\n", "hunter2", fieldList{}},
+		{"bare password wins", nil, "hunter2\npassword: old\n", "hunter2", fieldList{{"password", "old"}}},
+		{"custom alias", []string{"--password-field", "secret"}, "secret: hunter2\npassword: x\n", "hunter2", fieldList{{"password", "x"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := buildEntry(parseArgv(t, tt.args...), "/shop.gpg", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.LoginPassword != tt.wantPassword || !reflect.DeepEqual(e.Fields, tt.wantFields) {
+				t.Errorf("got password %q and fields %v, want %q and %v", e.LoginPassword, e.Fields, tt.wantPassword, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestSubmodule(t *testing.T) {
+	// personal is a git submodule with its repository in the .git of the
+	// store, vendor/lib a nested clone with a .git of its own
+	files := map[string]string{
+		"mail":                                "pw\n",
+		"personal/bank":                       "pw\n",
+		"personal/shop/amazon":                "pw\n",
+		".git/modules/personal/objects/ab/cd": "not a password\n",
+		".git/refs/stash":                     "not a password\n",
+		"personal/vendor/lib/.git/objects/ef": "not a password\n",
+	}
+	out, err := exportStore(t, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/|mail", "personal/shop|amazon", "personal|bank"}
+	if got := folderNames(t, out); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSubmoduleRecipients(t *testing.T) {
+	root := writeStore(t, map[string]string{
+		"mail":                                "pw\n",
+		"personal/bank":                       "pw\n",
+		".git/modules/personal/objects/ab/cd": "x\n",
+	})
+	for path, content := range map[string]string{
+		".gpg-id":          "alice@example.com\n",
+		"personal/.gpg-id": "bob@example.com\n",
+		"personal/.git":    "gitdir: ../.git/modules/personal\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(path)), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	warnings, err := checkRecipients(root, []string{"alice@example.com"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{fmt.Sprintf("1 passwords below %s are encrypted for bob@example.com, none of which has a secret key available", filepath.Join(root, "personal"))}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("got %q, want %q", warnings, want)
+	}
+}
+
+func TestNameTemplate(t *testing.T) {
+	files := map[string]string{"mail": "pw\n", "work/github": "pw\n", "work/ci/jenkins": "pw\n"}
+	tests := []struct {
+		name     string
+		template string
+		want     []string
+	}{
+		{"default", "", []string{"/|mail", "work/ci|jenkins", "work|github"}},
+		{"folder", "{{.Name}}{{if .Folder}} ({{.Folder}}){{end}}", []string{"/|mail", "work/ci|jenkins (work/ci)", "work|github (work)"}},
+		{"path", "{{.Path}}", []string{"/|mail", "work/ci|work/ci/jenkins", "work|work/github"}},
+		{"empty name keeps the base name", "{{if .Folder}}{{.Name}} ({{.Folder}}){{end}}", []string{"/|mail", "work/ci|jenkins (work/ci)", "work|github (work)"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var args []string
+			if tt.template != "" {
+				args = []string{"--name-template", tt.template}
+			}
+			out, err := exportStore(t, files, args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := folderNames(t, out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidNameTemplate(t *testing.T) {
+	if _, err := exportStore(t, map[string]string{"mail": "pw\n"}, "--name-template", "{{.Name"); !errors.Is(err, errUsage) {
+		t.Errorf("got %v, want %v", err, errUsage)
+	}
+}
+
+func TestOnlyWithTOTP(t *testing.T) {
+	files := map[string]string{
+		"github": "pw\ntotp: JBSWY3DPEHPK3PXP\n",
+		"gitlab": "pw\notpauth://totp/gitlab?secret=JBSWY3DPEHPK3PXP\n",
+		"mail":   "pw\nlogin: me\n",
+		"wifi":   "\njust a note\n",
+		"otp":    "pw\notp: sms\n",
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		want       []string
+		wantNoTOTP int
+	}{
+		{"all", nil, []string{"/|github", "/|gitlab", "/|mail", "/|otp", "/|wifi"}, 0},
+		{"only with totp", []string{"--only-with-totp"}, []string{"/|github", "/|gitlab"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "report.json")
+			out, err := exportStore(t, files, append(tt.args, "--report-json", path)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := folderNames(t, out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for _, row := range csvRows(t, out) {
+				if tt.wantNoTOTP > 0 && (row["login_totp"] == "" || row["type"] != "totp") {
+					t.Errorf("%s: got type %q and TOTP %q, want a totp entry", row["name"], row["type"], row["login_totp"])
+				}
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var r report
+			if err := json.Unmarshal(data, &r); err != nil {
+				t.Fatal(err)
+			}
+			if r.NoTOTP != tt.wantNoTOTP {
+				t.Errorf("got %d left out without TOTP, want %d", r.NoTOTP, tt.wantNoTOTP)
+			}
+		})
+	}
+}
+
+func TestRefuseEmpty(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		args    []string
+		wantErr bool
+	}{
+		{"empty store", nil, nil, false},
+		{"empty store refused", nil, []string{"--refuse-empty"}, true},
+		{"nothing exported refused", map[string]string{"mail": "pw\n"}, []string{"--refuse-empty", "--only-with-totp"}, true},
+		{"entries", map[string]string{"mail": "pw\n"}, []string{"--refuse-empty"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := exportStore(t, tt.files, tt.args...)
+			if got := err != nil; got != tt.wantErr {
+				t.Errorf("got %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+	if code := runCode("--no-unlock", "--refuse-empty", "--password-store", t.TempDir(), "-o", filepath.Join(t.TempDir(), "out")); code == 0 {
+		t.Error("got exit code 0 for a refused export")
+	}
+}
+
+func TestKeepSourcePath(t *testing.T) {
+	files := map[string]string{"mail": "pw\n", "work/ci/jenkins": "pw\nsource: cli\n"}
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{"off", nil, map[string]string{"mail": "", "jenkins": "source: cli\n"}},
+		{"on", []string{"--keep-source-path"}, map[string]string{"mail": "source: mail\n", "jenkins": "source: cli\nsource_2: work/ci/jenkins\n"}},
+		{"full path names", []string{"--keep-source-path", "--full-path-name"}, map[string]string{"mail": "source: mail\n", "work/ci/jenkins": "source: cli\nsource_2: work/ci/jenkins\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, files, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, row := range csvRows(t, out) {
+				got[row["name"]] = row["fields"]
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONBody(t *testing.T) {
+	tests := []struct {
+		fixture    string
+		wantTOTP   string
+		wantFields fieldList
+	}{
+		{"body.txt", "otpauth://totp/shop?secret=JBSWY3DPEHPK3PXP", fieldList{
+			{"account", "0042"}, {"security", `{"answer":"rex","question":"first pet"}`},
+		}},
+		{"after-password.txt", "", fieldList{{"account", "0042"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", "json", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			e, err := buildEntry(parseArgv(t), "/shop.gpg", content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.LoginPassword != "hunter2" || e.LoginUsername != "me" || e.LoginURI != "https://shop.example.com" || e.LoginTOTP != tt.wantTOTP {
+				t.Errorf("got password %q, username %q, uri %q and TOTP %q", e.LoginPassword, e.LoginUsername, e.LoginURI, e.LoginTOTP)
+			}
+			if !reflect.DeepEqual(e.Fields, tt.wantFields) || e.Notes != "" {
+				t.Errorf("got fields %v and notes %q, want %v and no notes", e.Fields, e.Notes, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestMinimal(t *testing.T) {
+	files := map[string]string{
+		"shop":  "pw\nlogin: me\nurl: https://shop.example.com\ntotp: JBSWY3DPEHPK3PXP\naccount: 0042\npin: 1234\n",
+		"notes": "pw\nsome: notes\n---\nmore\n",
+		"wifi":  "\njust a note\n",
+	}
+	out, err := exportStore(t, files, "--minimal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := csvRows(t, out)
+	if got := folderNames(t, out); !reflect.DeepEqual(got, []string{"/|notes", "/|shop"}) {
+		t.Errorf("got %q, want the note without a password left out", got)
+	}
+	for _, row := range rows {
+		if row["notes"] != "" || row["fields"] != "" {
+			t.Errorf("%s: got notes %q and fields %q, want none", row["name"], row["notes"], row["fields"])
+		}
+		if row["name"] == "shop" && (row["login_username"] != "me" || row["login_password"] != "pw" ||
+			row["login_uri"] != "https://shop.example.com" || row["login_totp"] != "JBSWY3DPEHPK3PXP") {
+			t.Errorf("got %v, want the credentials of shop kept", row)
+		}
+	}
+}
+
+func TestTitleField(t *testing.T) {
+	tests := []struct {
+		name, content string
+		args          []string
+		wantName      string
+		wantFields    fieldList
+	}{
+		{"off", "pw\ntitle: GitHub (work)\n", nil, "x7f3a", fieldList{{"title", "GitHub (work)"}}},
+		{"field", "pw\ntitle: GitHub (work)\nlogin: me\n", []string{"--title-field", "title"}, "GitHub (work)", fieldList{}},
+		{"case-insensitive", "pw\nTitle: GitHub\n", []string{"--title-field", "title"}, "GitHub", fieldList{}},
+		{"comment", "pw\n# GitHub (work)\nlogin: me\n", []string{"--title-field", "title"}, "GitHub (work)", fieldList{}},
+		{"field wins over comment", "pw\n# comment\nname: GitHub\n", []string{"--title-field", "name"}, "GitHub", fieldList{}},
+		{"absent", "pw\nlogin: me\n", []string{"--title-field", "title"}, "x7f3a", fieldList{}},
+		{"blank", "pw\ntitle: \" \"\n", []string{"--title-field", "title"}, "x7f3a", fieldList{{"title", " "}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := buildEntry(parseArgv(t, tt.args...), "/work/x7f3a.gpg", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Name != tt.wantName || e.Folder != "work" || !reflect.DeepEqual(e.Fields, tt.wantFields) {
+				t.Errorf("got folder %q, name %q and fields %v, want work, %q and %v", e.Folder, e.Name, e.Fields, tt.wantName, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		cpu, mem bool
+	}{
+		{"off", false, false},
+		{"cpu", true, false},
+		{"memory", false, true},
+		{"both", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cpu, mem := filepath.Join(dir, "cpu.pprof"), filepath.Join(dir, "mem.pprof")
+			var args []string
+			if tt.cpu {
+				args = append(args, "--cpuprofile", cpu)
+			}
+			if tt.mem {
+				args = append(args, "--memprofile", mem)
+			}
+			if _, err := exportStore(t, map[string]string{"mail": "pw\n"}, args...); err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range map[string]bool{cpu: tt.cpu, mem: tt.mem} {
+				info, err := os.Stat(path)
+				switch {
+				case want && err != nil:
+					t.Errorf("%s was not written: %v", filepath.Base(path), err)
+				case want && info.Size() == 0:
+					t.Errorf("%s is empty", filepath.Base(path))
+				case !want && err == nil:
+					t.Errorf("%s was written without its flag", filepath.Base(path))
+				}
+			}
+		})
+	}
+}
+
+func TestLongPasswordLine(t *testing.T) {
+	blob := strings.Repeat("QUJD", 5000)
+	tests := []struct {
+		name         string
+		args         []string
+		content      string
+		wantPassword string
+		wantNotes    string
+	}{
+		{"blob", nil, blob + "\n", "", blob + "\n"},
+		{"blob before notes", []string{"--strict-fields"}, blob + "\nlogin: me\nkept notes\n", "", blob + "\nkept notes\n"},
+		{"short password", nil, "hunter2\n", "hunter2", ""},
+		{"custom limit", []string{"--max-password-len", "5"}, "hunter2\n", "", "hunter2\n"},
+		{"no limit", []string{"--max-password-len", "0"}, blob + "\n", blob, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := buildEntry(parseArgv(t, tt.args...), "/blob.gpg", []byte(tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.LoginPassword != tt.wantPassword || e.Notes != tt.wantNotes {
+				t.Errorf("got a password of %d and notes of %d characters, want %d and %d",
+					len(e.LoginPassword), len(e.Notes), len(tt.wantPassword), len(tt.wantNotes))
+			}
+		})
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	tests := []struct {
+		fname, wantFolder, wantName string
+	}{
+		{"/mail.gpg", "/", "mail"},
+		{"/web/github.gpg", "web", "github"},
+		{"//web//shop///amazon.gpg", "web/shop", "amazon"},
+		{"/./web/./github.gpg", "web", "github"},
+		{"/a/b/c/d/e/f.gpg", "a/b/c/d/e", "f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fname, func(t *testing.T) {
+			folder, name := splitName(filepath.FromSlash(tt.fname))
+			if folder != tt.wantFolder || name != tt.wantName {
+				t.Errorf("got %q and %q, want %q and %q", folder, name, tt.wantFolder, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestStorePathWithTrailingSlash(t *testing.T) {
+	fakeGPG(t, catGPG)
+	store := writeStore(t, map[string]string{"mail": "pw\n", "a/b/c/d/deep": "pw\n", "web/github": "pw\n"})
+	want := []string{"/|mail", "a/b/c/d|deep", "web|github"}
+	for _, path := range []string{store, store + "/", store + "//", store + "/./", store + "/web/.."} {
+		t.Run(path[len(store):], func(t *testing.T) {
+			out := filepath.Join(t.TempDir(), "out")
+			if err := runArgs("--no-unlock", "--password-store", path, "-o", out); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := os.ReadFile(out)
+			if names := folderNames(t, string(got)); !reflect.DeepEqual(names, want) {
+				t.Errorf("got %q, want %q", names, want)
+			}
+		})
+	}
+}
+
+func TestContentMatch(t *testing.T) {
+	files := map[string]string{
+		"aws/prod": "pw\naws_access_key_id: AKIA\n",
+		"aws/dev":  "pw\nAWS_ACCESS_KEY_ID: AKIB\n",
+		"mail":     "pw\nlogin: me\n",
+		"notes":    "pw\nsee the AWS console\n",
+		"shop":     "pw\nurl: https://shop.example.com\n",
+	}
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{"all", nil, []string{"/|mail", "/|notes", "/|shop", "aws|dev", "aws|prod"}, false},
+		{"plain", []string{"--content-match", "aws"}, []string{"aws|prod"}, false},
+		{"ignore case", []string{"--content-match", "aws", "--content-match-ignore-case"}, []string{"/|notes", "aws|dev", "aws|prod"}, false},
+		{"regexp", []string{"--content-match", `AKI[AB]|example\.com`}, []string{"/|shop", "aws|dev", "aws|prod"}, false},
+		{"store path is not content", []string{"--content-match", "prod"}, nil, false},
+		{"invalid regexp", []string{"--content-match", "aws("}, nil, true},
+		{"ignore case alone", []string{"--content-match-ignore-case"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exportStore(t, files, tt.args...)
+			if tt.wantErr {
+				if !errors.Is(err, errUsage) {
+					t.Errorf("got %v, want %v", err, errUsage)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := folderNames(t, out); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
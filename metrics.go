@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// metricsHook receives timing events from the export pipeline. A nil hook
+// disables timing entirely.
+type metricsHook interface {
+	entryDecrypted(fname string, d time.Duration)
+	exportFinished(elapsed time.Duration)
+}
+
+// verboseMetrics prints the duration of every decryption and a summary of
+// the whole export, as shown by --verbose.
+type verboseMetrics struct {
+	out io.Writer
+	// expected is the number of passwords to decrypt, if known.
+	expected int
+
+	count   int
+	total   time.Duration
+	slowest time.Duration
+}
+
+func (m *verboseMetrics) entryDecrypted(fname string, d time.Duration) {
+	m.count++
+	m.total += d
+	if d > m.slowest {
+		m.slowest = d
+	}
+	if m.expected > 0 {
+		fmt.Fprintf(m.out, "[%d/%d] ", m.count, m.expected)
+	}
+	fmt.Fprintf(m.out, "Decrypted %s in %s\n", fname, d)
+}
+
+func (m *verboseMetrics) exportFinished(elapsed time.Duration) {
+	var avg time.Duration
+	if m.count > 0 {
+		avg = m.total / time.Duration(m.count)
+	}
+	fmt.Fprintf(m.out, "Exported %d entries in %s (decrypt total %s, average %s, slowest %s)\n",
+		m.count, elapsed, m.total, avg, m.slowest)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingHook records the decrypted passwords of the export pipeline.
+type recordingHook struct {
+	decrypted []string
+}
+
+func (h *recordingHook) entryDecrypted(fname string, d time.Duration) {
+	h.decrypted = append(h.decrypted, fname)
+}
+
+func (h *recordingHook) exportFinished(elapsed time.Duration) {}
+
+func TestMetricsHook(t *testing.T) {
+	fakeGPG(t, catGPG)
+	store := writeStore(t, map[string]string{"a": "pw\n", "web/b": "pw\n", "web/c": "pw\n"})
+	for _, hook := range []*recordingHook{nil, {}} {
+		argv := parseArgv(t, "--password-store", store)
+		var h metricsHook
+		if hook != nil {
+			h = hook
+		}
+		entries, errc := parseStores(argv, &summary{}, h, make(chan struct{}), nil)
+		if got := len(collect(entries)); got != 3 {
+			t.Errorf("got %d entries, want 3", got)
+		}
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+		if hook == nil {
+			continue
+		}
+		sort.Strings(hook.decrypted)
+		if want := []string{"/a.gpg", "/web/b.gpg", "/web/c.gpg"}; !reflect.DeepEqual(hook.decrypted, want) {
+			t.Errorf("got events for %v, want %v", hook.decrypted, want)
+		}
+	}
+}
+
+func TestVerboseMetrics(t *testing.T) {
+	var out bytes.Buffer
+	m := &verboseMetrics{out: &out, expected: 2}
+	m.entryDecrypted("/a.gpg", 10*time.Millisecond)
+	m.entryDecrypted("/b.gpg", 30*time.Millisecond)
+	m.exportFinished(time.Second)
+	want := []string{
+		"[1/2] Decrypted /a.gpg in 10ms",
+		"[2/2] Decrypted /b.gpg in 30ms",
+		"Exported 2 entries in 1s (decrypt total 40ms, average 20ms, slowest 30ms)",
+	}
+	if got := strings.Split(strings.TrimSpace(out.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// migrationBatchSize is the number of accounts per otpauth-migration URI,
+// which keeps the QR codes made from them scannable.
+const migrationBatchSize = 10
+
+// otpParameters is one account of an otpauth-migration payload.
+type otpParameters struct {
+	secret    []byte
+	name      string
+	issuer    string
+	algorithm int // 1 SHA1, 2 SHA256, 3 SHA512, 4 MD5
+	digits    int // 1 six, 2 eight
+}
+
+// protoBuffer writes the few protobuf wire types the payload needs.
+type protoBuffer []byte
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		*b = append(*b, byte(v)|0x80)
+		v >>= 7
+	}
+	*b = append(*b, byte(v))
+}
+
+func (b *protoBuffer) uint(field int, v uint64) {
+	b.varint(uint64(field)<<3 | 0)
+	b.varint(v)
+}
+
+func (b *protoBuffer) bytes(field int, v []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(v)))
+	*b = append(*b, v...)
+}
+
+func (p otpParameters) marshal() []byte {
+	var b protoBuffer
+	b.bytes(1, p.secret)
+	b.bytes(2, []byte(p.name))
+	if p.issuer != "" {
+		b.bytes(3, []byte(p.issuer))
+	}
+	b.uint(4, uint64(p.algorithm))
+	b.uint(5, uint64(p.digits))
+	b.uint(6, 2) // TOTP
+	return b
+}
+
+// migrationPayload encodes a MigrationPayload message.
+func migrationPayload(accounts []otpParameters, batchSize, batchIndex, batchID int) []byte {
+	var b protoBuffer
+	for _, a := range accounts {
+		b.bytes(1, a.marshal())
+	}
+	b.uint(2, 1) // version
+	b.uint(3, uint64(batchSize))
+	b.uint(4, uint64(batchIndex))
+	b.uint(5, uint64(batchID))
+	return b
+}
+
+// otpParametersFor reads the TOTP secret of e, a bare secret or an
+// otpauth URI.
+func otpParametersFor(e *entry) (otpParameters, error) {
+	p := otpParameters{name: e.Name, algorithm: 1, digits: 1}
+	secret := e.LoginTOTP
+	if strings.HasPrefix(strings.ToLower(secret), "otpauth://") {
+		u, err := url.Parse(secret)
+		if err != nil {
+			return p, err
+		}
+		if u.Host != "totp" {
+			return p, fmt.Errorf("%s codes are not supported", u.Host)
+		}
+		q := u.Query()
+		secret = q.Get("secret")
+		if label := strings.TrimPrefix(u.Path, "/"); label != "" {
+			p.name = label
+		}
+		p.issuer = q.Get("issuer")
+		switch strings.ToUpper(q.Get("algorithm")) {
+		case "", "SHA1":
+		case "SHA256":
+			p.algorithm = 2
+		case "SHA512":
+			p.algorithm = 3
+		case "MD5":
+			p.algorithm = 4
+		default:
+			return p, fmt.Errorf("unknown algorithm %s", q.Get("algorithm"))
+		}
+		switch q.Get("digits") {
+		case "", "6":
+		case "8":
+			p.digits = 2
+		default:
+			return p, fmt.Errorf("%s digits are not supported", q.Get("digits"))
+		}
+		if period := q.Get("period"); period != "" && period != "30" {
+			return p, fmt.Errorf("a period of %ss is not supported", period)
+		}
+	}
+	secret = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil {
+		return p, fmt.Errorf("secret is not base32: %w", err)
+	}
+	if len(key) == 0 {
+		return p, errors.New("secret is empty")
+	}
+	p.secret = key
+	return p, nil
+}
+
+// writeTOTPMigration writes otpauth-migration URIs holding the TOTP secrets
+// of entries, one per line, for importing them into Google Authenticator.
+// Entries without a TOTP secret are left out.
+func writeTOTPMigration(out io.Writer, entries <-chan *entry) error {
+	var accounts []otpParameters
+	batchID := fnv.New32a()
+	for e := range entries {
+		if e.LoginTOTP == "" {
+			continue
+		}
+		p, err := otpParametersFor(e)
+		if err != nil {
+			warnf("Leaving out TOTP of %s: %s\n", e.Name, err)
+			continue
+		}
+		accounts = append(accounts, p)
+		batchID.Write(p.secret)
+	}
+
+	w := bufio.NewWriter(out)
+	batches := (len(accounts) + migrationBatchSize - 1) / migrationBatchSize
+	for i := 0; i < batches; i++ {
+		end := (i + 1) * migrationBatchSize
+		if end > len(accounts) {
+			end = len(accounts)
+		}
+		// batch ids are int32
+		data := migrationPayload(accounts[i*migrationBatchSize:end], batches, i, int(batchID.Sum32()&0x7fffffff))
+		fmt.Fprintf(w, "otpauth-migration://offline?data=%s\n", url.QueryEscape(base64.StdEncoding.EncodeToString(data)))
+	}
+	return w.Flush()
+}
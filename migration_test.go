@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMigrationPayload(t *testing.T) {
+	e := &entry{Name: "shop", LoginTOTP: "otpauth://totp/alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&digits=8&algorithm=SHA256"}
+	p, err := otpParametersFor(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := migrationPayload([]otpParameters{p}, 1, 0, 7)
+	want := []byte{
+		0x0a, 0x2e, // otp_parameters, 46 bytes
+		0x0a, 0x0a, 'H', 'e', 'l', 'l', 'o', '!', 0xde, 0xad, 0xbe, 0xef, // secret
+		0x12, 0x11, 'a', 'l', 'i', 'c', 'e', '@', 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', // name
+		0x1a, 0x07, 'E', 'x', 'a', 'm', 'p', 'l', 'e', // issuer
+		0x20, 0x02, // algorithm SHA256
+		0x28, 0x02, // digits eight
+		0x30, 0x02, // type TOTP
+		0x10, 0x01, // version
+		0x18, 0x01, // batch_size
+		0x20, 0x00, // batch_index
+		0x28, 0x07, // batch_id
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got\n% x\nwant\n% x", got, want)
+	}
+}
+
+func TestOTPParametersFor(t *testing.T) {
+	tests := []struct {
+		name, totp string
+		wantErr    bool
+	}{
+		{"bare secret", "jbsw y3dp ehpk 3pxp", false},
+		{"uri", "otpauth://totp/a?secret=JBSWY3DPEHPK3PXP", false},
+		{"hotp", "otpauth://hotp/a?secret=JBSWY3DPEHPK3PXP&counter=1", true},
+		{"period", "otpauth://totp/a?secret=JBSWY3DPEHPK3PXP&period=60", true},
+		{"not base32", "not a secret!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := otpParametersFor(&entry{Name: "a", LoginTOTP: tt.totp}); (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want an error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteTOTPMigrationBatches(t *testing.T) {
+	var entries []*entry
+	for i := 0; i < migrationBatchSize+1; i++ {
+		entries = append(entries, &entry{Name: "a", LoginTOTP: "JBSWY3DPEHPK3PXP"})
+	}
+	entries = append(entries, &entry{Name: "no totp"})
+	var out bytes.Buffer
+	if err := writeTOTPMigration(&out, entryChan(entries...)); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d URIs, want 2", len(lines))
+	}
+	for i, line := range lines {
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme != "otpauth-migration" {
+			t.Fatalf("got %q", line)
+		}
+		data, err := base64.StdEncoding.DecodeString(u.Query().Get("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// batch_size and batch_index follow the accounts
+		if !bytes.Contains(data, []byte{0x10, 0x01, 0x18, 0x02, 0x20, byte(i)}) {
+			t.Errorf("URI %d: payload % x has no batch %d of 2", i, data, i)
+		}
+	}
+}
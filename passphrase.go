@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"golang.org/x/term"
+)
+
+// readPassphrase asks for the gpg passphrase on the terminal without
+// echoing it.
+func readPassphrase() ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("--prompt-once needs a terminal: %w", err)
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, "gpg passphrase: ")
+	passphrase, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("no passphrase given")
+	}
+	return passphrase, nil
+}
+
+// zero overwrites b so the passphrase does not linger in memory.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// decryptCommand returns the gpg command decrypting path. With a
+// passphrase gpg reads it from stdin instead of asking gpg-agent.
+func decryptCommand(path string, passphrase []byte) *exec.Cmd {
+	if passphrase == nil {
+		return exec.Command("gpg", "-qd", path)
+	}
+	cmd := exec.Command("gpg", "--batch", "--pinentry-mode", "loopback", "--passphrase-fd", "0", "-qd", path)
+	cmd.Stdin = bytes.NewReader(passphrase)
+	return cmd
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPassphraseForEveryEntry(t *testing.T) {
+	log := filepath.Join(t.TempDir(), "stdin")
+	// gpg records the passphrase it reads from fd 0, one line per call
+	fakeGPG(t, `cat >> "`+log+`"; echo >> "`+log+`"; `+catGPG)
+	store := writeStore(t, map[string]string{"a": "pw a\n", "b": "pw b\n", "web/c": "pw c\n"})
+	passphrase := []byte("correct horse")
+	for _, name := range []string{"a", "b", "web/c"} {
+		out, _, err := runDecrypt(filepath.Join(store, name+".gpg"), passphrase)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if want := "pw " + filepath.Base(name) + "\n"; string(out) != want {
+			t.Errorf("%s: got %q, want %q", name, out, want)
+		}
+	}
+	got, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Repeat("correct horse\n", 3); string(got) != want {
+		t.Errorf("gpg read %q, want %q", got, want)
+	}
+}
+
+func TestDecryptCommand(t *testing.T) {
+	if cmd := decryptCommand("a.gpg", nil); cmd.Stdin != nil || strings.Join(cmd.Args, " ") != "gpg -qd a.gpg" {
+		t.Errorf("without passphrase: got %q", cmd.Args)
+	}
+	cmd := decryptCommand("a.gpg", []byte("x"))
+	if want := "gpg --batch --pinentry-mode loopback --passphrase-fd 0 -qd a.gpg"; strings.Join(cmd.Args, " ") != want {
+		t.Errorf("with passphrase: got %q, want %q", cmd.Args, want)
+	}
+}
+
+func TestZero(t *testing.T) {
+	b := []byte("secret")
+	zero(b)
+	if string(b) != "\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("got %q", b)
+	}
+}
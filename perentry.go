@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// unsafeFileChars matches everything that should not end up in a file name.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._ -]`)
+
+// sanitizeFileName makes name usable as a single path component, writing
+// replacement for every unsafe character. Names that are empty, . or .. get
+// replacement in front, or _ if that does not help.
+func sanitizeFileName(name, replacement string) string {
+	name = unsafeFileChars.ReplaceAllLiteralString(name, replacement)
+	if isDotName(name) {
+		name = replacement + name
+	}
+	if isDotName(name) {
+		name = "_" + name
+	}
+	return name
+}
+
+// isDotName reports whether name cannot be a file name of its own.
+func isDotName(name string) bool {
+	return name == "" || name == "." || name == ".."
+}
+
+// entryFileName returns the file e is written to below the output
+// directory, relative to it. With nested the folders of e become
+// directories, otherwise they are part of the file name.
+func entryFileName(e *entry, nested bool, replacement string) string {
+	var parts []string
+	for _, folder := range strings.Split(e.Folder, "/") {
+		if folder != "" {
+			parts = append(parts, sanitizeFileName(folder, replacement))
+		}
+	}
+	name := sanitizeFileName(e.Name, replacement)
+	if nested {
+		return filepath.Join(append(parts, name)...)
+	}
+	return strings.Join(append(parts, name), "_")
+}
+
+// writePerEntry writes every entry to its own file in dir using f. Names
+// that are already taken after sanitizing get a numeric suffix.
+func writePerEntry(dir string, nested bool, replacement string, f format, entries <-chan *entry) error {
+	used := make(map[string]bool)
+	for e := range entries {
+		base := entryFileName(e, nested, replacement)
+		name := base
+		for i := 2; used[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		used[strings.ToLower(name)] = true
+
+		path := filepath.Join(dir, name+f.ext)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		single := make(chan *entry, 1)
+		single <- e
+		close(single)
+		err = f.write(file, single)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name, replacement, want string
+	}{
+		{"github", "_", "github"},
+		{"me@example.com", "_", "me_example.com"},
+		{"a/b\\c:d", "-", "a-b-c-d"},
+		{"bücher", "_", "b_cher"},
+		{"", "_", "_"},
+		{"", "-", "-"},
+		{"..", "_", "_.."},
+		{"..", "-", "-.."},
+		{".", "", "_."},
+		{".", ".", "_.."},
+		{"a*b", "", "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeFileName(tt.name, tt.replacement); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWritePerEntry(t *testing.T) {
+	entries := func() []*entry {
+		return []*entry{
+			{Folder: "/", Name: "mail", Type: "login"},
+			{Folder: "web/shop", Name: "amazon.de", Type: "login"},
+			{Folder: "web", Name: "me@example.com", Type: "login"},
+			{Folder: "web", Name: "me#example.com", Type: "login"},
+			{Folder: "web", Name: "Me@example.com", Type: "login"},
+		}
+	}
+	tests := []struct {
+		name   string
+		nested bool
+		want   []string
+	}{
+		{"flat", false, []string{
+			"mail.csv", "web_Me_example.com_3.csv", "web_me_example.com.csv",
+			"web_me_example.com_2.csv", "web_shop_amazon.de.csv",
+		}},
+		{"nested", true, []string{
+			"mail.csv", "web/Me_example.com_3.csv", "web/me_example.com.csv",
+			"web/me_example.com_2.csv", "web/shop/amazon.de.csv",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := writePerEntry(dir, tt.nested, "_", formats["bitwarden"], entryChan(entries()...)); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, err := filepath.Rel(dir, path)
+				got = append(got, filepath.ToSlash(rel))
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntryFileName(t *testing.T) {
+	tests := []struct {
+		name        string
+		e           entry
+		nested      bool
+		replacement string
+		want        string
+	}{
+		{"slash and colon", entry{Folder: "/", Name: "a/b:c"}, false, "_", "a_b_c"},
+		{"replacement", entry{Folder: "web", Name: "http://x"}, false, "-", "web_http---x"},
+		{"nested", entry{Folder: "we:b/shop", Name: "a/b"}, true, "_", filepath.Join("we_b", "shop", "a_b")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.e
+			if got := entryFileName(&e, tt.nested, tt.replacement); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if e.Folder != tt.e.Folder || e.Name != tt.e.Name {
+				t.Errorf("got folder %q and name %q, want them unchanged", e.Folder, e.Name)
+			}
+		})
+	}
+}
+
+func TestPerEntryNamesKeepTheirText(t *testing.T) {
+	fakeGPG(t, catGPG)
+	store := writeStore(t, map[string]string{"work/github": "pw\n", "work_github": "pw\n"})
+	dir := t.TempDir()
+	err := runArgs("--no-unlock", "--password-store", store, "--per-entry", "--output-dir", dir,
+		"--name-template", "{{.Path}}: login", "--name-sanitize-replacement=-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, file := range []string{"work_work-github- login.csv", "work_github- login.csv"} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[file] = csvRows(t, string(data))[0]["name"]
+	}
+	want := map[string]string{"work_work-github- login.csv": "work/github: login", "work_github- login.csv": "work_github: login"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNameSanitizeReplacementValidated(t *testing.T) {
+	if err := runArgs("--no-unlock", "--password-store", t.TempDir(), "--per-entry", "--output-dir", t.TempDir(),
+		"--name-sanitize-replacement", "/"); !errors.Is(err, errUsage) {
+		t.Errorf("got %v, want %v", err, errUsage)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+// startProfiles starts a CPU profile written to cpu and returns a function
+// that stops it and writes a heap profile to mem. Empty names disable the
+// profile.
+func startProfiles(cpu, mem string) (func(), error) {
+	var cpuFile *os.File
+	if cpu != "" {
+		f, err := os.Create(cpu)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		cpuFile = f
+	}
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			cpuFile.Close()
+		}
+		if mem == "" {
+			return
+		}
+		f, err := os.Create(mem)
+		if err != nil {
+			errorf("Could not write memory profile: %s\n", err)
+			return
+		}
+		defer f.Close()
+		// only count what is still in use
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			errorf("Could not write memory profile: %s\n", err)
+		}
+	}, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// secretKeys returns the fingerprints and user ids of the secret keys gpg
+// has available.
+func secretKeys() ([]string, error) {
+	out, err := exec.Command("gpg", "--list-secret-keys", "--with-colons").Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list secret keys: %w", err)
+	}
+	return parseSecretKeys(string(out)), nil
+}
+
+// parseSecretKeys reads the fpr and uid records of gpg --with-colons
+// output. For user ids the email address is added on its own as well.
+func parseSecretKeys(out string) []string {
+	var keys []string
+	for _, line := range strings.Split(out, "\n") {
+		record := strings.Split(line, ":")
+		if len(record) < 10 || record[9] == "" {
+			continue
+		}
+		switch record[0] {
+		case "fpr":
+			keys = append(keys, record[9])
+		case "uid":
+			uid := record[9]
+			keys = append(keys, uid)
+			if i, j := strings.Index(uid, "<"), strings.LastIndex(uid, ">"); i >= 0 && j > i {
+				keys = append(keys, uid[i+1:j])
+			}
+		}
+	}
+	return keys
+}
+
+// hasSecretKey reports whether recipient, a fingerprint, key id, email or
+// user id as found in .gpg-id, is one of keys.
+func hasSecretKey(recipient string, keys []string) bool {
+	recipient = strings.TrimPrefix(strings.TrimPrefix(recipient, "0x"), "0X")
+	for _, key := range keys {
+		if strings.EqualFold(key, recipient) {
+			return true
+		}
+		// key ids are the end of the fingerprint
+		if len(recipient) >= 8 && len(key) > len(recipient) &&
+			strings.EqualFold(key[len(key)-len(recipient):], recipient) {
+			return true
+		}
+	}
+	return false
+}
+
+func readGPGID(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			recipients = append(recipients, line)
+		}
+	}
+	return recipients, nil
+}
+
+// checkRecipients returns a warning for every .gpg-id below root whose
+// passwords are not encrypted for any of keys, so they will fail to
+// decrypt.
+func checkRecipients(root string, keys []string, strict bool) ([]string, error) {
+	// gpgIDs caches the .gpg-id governing every directory, "" for none
+	gpgIDs := map[string]string{}
+	var governing func(dir string) string
+	governing = func(dir string) string {
+		if id, ok := gpgIDs[dir]; ok {
+			return id
+		}
+		id := filepath.Join(dir, ".gpg-id")
+		if _, err := os.Stat(id); err != nil {
+			id = ""
+			if parent := filepath.Dir(dir); dir != root && parent != dir {
+				id = governing(parent)
+			}
+		}
+		gpgIDs[dir] = id
+		return id
+	}
+
+	counts := map[string]int{}
+	var order []string
+	err := walkStore(root, skipUnreadable(root, strict, nil, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !isPasswordFile(path, info) {
+			return nil
+		}
+		id := governing(filepath.Dir(path))
+		if id == "" {
+			return nil
+		}
+		if _, ok := counts[id]; !ok {
+			order = append(order, id)
+		}
+		counts[id]++
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, id := range order {
+		recipients, err := readGPGID(id)
+		if err != nil {
+			return nil, err
+		}
+		covered := false
+		for _, r := range recipients {
+			if hasSecretKey(r, keys) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			warnings = append(warnings, fmt.Sprintf("%d passwords below %s are encrypted for %s, none of which has a secret key available",
+				counts[id], filepath.Dir(id), strings.Join(recipients, ", ")))
+		}
+	}
+	return warnings, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// secretKeyList is gpg --list-secret-keys --with-colons output for a single
+// key of alice.
+const secretKeyList = `sec:u:255:22:8A3F1C2D4E5B6A79:1700000000:::u:::scESC:::+:::ed25519:::0:
+fpr:::::::::0123456789ABCDEF01238A3F1C2D4E5B6A79:
+grp:::::::::45E1A06F2B3C4D5E6F7081920A1B2C3D4E5F6071:
+uid:u::::1700000000::AB12CD34EF56AB78CD90EF12AB34CD56EF78AB90::Alice Example <alice@example.com>::::::::::0:
+ssb:u:255:18:1B2C3D4E5F607182:1700000000::::::e:::+:::cv25519::
+fpr:::::::::FEDCBA98765432101B2C3D4E5F607182:
+`
+
+func TestParseSecretKeys(t *testing.T) {
+	want := []string{
+		"0123456789ABCDEF01238A3F1C2D4E5B6A79",
+		"Alice Example <alice@example.com>",
+		"alice@example.com",
+		"FEDCBA98765432101B2C3D4E5F607182",
+	}
+	if got := parseSecretKeys(secretKeyList); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestHasSecretKey(t *testing.T) {
+	keys := parseSecretKeys(secretKeyList)
+	tests := []struct {
+		recipient string
+		want      bool
+	}{
+		{"0123456789ABCDEF01238A3F1C2D4E5B6A79", true},
+		{"0123456789abcdef01238a3f1c2d4e5b6a79", true},
+		{"8A3F1C2D4E5B6A79", true},
+		{"0x8A3F1C2D4E5B6A79", true},
+		{"4E5B6A79", true},
+		{"alice@example.com", true},
+		{"Alice Example <alice@example.com>", true},
+		{"bob@example.com", false},
+		{"6A79", false},
+		{"FFFFFFFF4E5B6A79", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.recipient, func(t *testing.T) {
+			if got := hasSecretKey(tt.recipient, keys); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckRecipients(t *testing.T) {
+	root := writeStore(t, map[string]string{
+		"mail":               "pw\n",
+		"personal/bank":      "pw\n",
+		"work/ci/jenkins":    "pw\n",
+		"work/ci/gitlab":     "pw\n",
+		"work/shared/wiki":   "pw\n",
+		"work/shared/ldap":   "pw\n",
+		"work/shared/backup": "pw\n",
+	})
+	for path, recipients := range map[string]string{
+		".gpg-id":             "alice@example.com\n",
+		"work/.gpg-id":        "# the team key\nbob@example.com\n0xDEADBEEFDEADBEEF\n",
+		"work/shared/.gpg-id": "bob@example.com\n8A3F1C2D4E5B6A79\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(path)), []byte(recipients), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	warnings, err := checkRecipients(root, parseSecretKeys(secretKeyList), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("got warnings %q, want one for work", warnings)
+	}
+	want := "2 passwords below " + filepath.Join(root, "work") + " are encrypted for bob@example.com, 0xDEADBEEFDEADBEEF"
+	if !strings.HasPrefix(warnings[0], want) {
+		t.Errorf("got %q, want it to start with %q", warnings[0], want)
+	}
+}
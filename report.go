@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// report is the machine readable outcome of an export written by
+// --report-json.
+type report struct {
+	Started  time.Time      `json:"started"`
+	Duration float64        `json:"duration_seconds"`
+	Total    int            `json:"total"`
+	Exported int            `json:"exported"`
+	Skipped  int            `json:"skipped"`
+	Empty    int            `json:"empty"`
+	NoTOTP   int            `json:"without_totp"`
+	Minimal  int            `json:"minimal_empty"`
+	NoMatch  int            `json:"not_matching"`
+	Older    int            `json:"not_modified"`
+	ByType   map[string]int `json:"by_type"`
+	Failed   []failure      `json:"failed"`
+	Audit    *auditFindings `json:"audit,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// writeReport writes the report of an export that started at start and
+// ended with err to path. aud is nil without --audit.
+func writeReport(path string, sum *summary, aud *auditor, start time.Time, err error) error {
+	sum.mu.Lock()
+	r := report{
+		Started:  start,
+		Duration: time.Since(start).Seconds(),
+		Skipped:  sum.skipped,
+		Empty:    sum.empty,
+		NoTOTP:   sum.noTOTP,
+		Minimal:  sum.minimal,
+		NoMatch:  sum.noMatch,
+		Older:    sum.unmodified,
+		ByType:   map[string]int{},
+		Failed:   append([]failure{}, sum.failures...),
+	}
+	for typ, n := range sum.exported {
+		r.ByType[typ] = n
+		r.Exported += n
+	}
+	sum.mu.Unlock()
+	if aud != nil {
+		findings := aud.findings()
+		r.Audit = &findings
+	}
+	r.Total = r.Exported + r.Skipped + r.Empty + r.NoTOTP + r.Minimal + r.NoMatch + r.Older
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
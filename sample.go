@@ -0,0 +1,41 @@
+package main
+
+// sampleEntries passes on the first n entries, redacting their secrets if
+// redacted is set, and then calls stop to end decryption. sampled is set
+// once the sample is complete.
+func sampleEntries(entries <-chan *entry, n int, redacted bool, stop func(), sampled *bool) <-chan *entry {
+	c := make(chan *entry)
+	go func() {
+		defer close(c)
+		i := 0
+		for e := range entries {
+			if i == n {
+				// decryption is stopping, let it run empty
+				continue
+			}
+			if redacted {
+				redactEntry(e)
+			}
+			c <- e
+			if i++; i == n {
+				*sampled = true
+				stop()
+			}
+		}
+	}()
+	return c
+}
+
+// redactEntry replaces the password, TOTP secret, notes and field values of
+// e, hidden ones included, with their length.
+func redactEntry(e *entry) {
+	for _, v := range []*string{&e.LoginPassword, &e.LoginTOTP, &e.Notes} {
+		*v = redact(*v, false)
+	}
+	for i := range e.Fields {
+		e.Fields[i].value = redact(e.Fields[i].value, false)
+	}
+	for i := range e.hidden {
+		e.hidden[i].value = redact(e.hidden[i].value, false)
+	}
+}
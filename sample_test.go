@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSampleEntries(t *testing.T) {
+	tests := []struct {
+		name     string
+		n        int
+		entries  int
+		want     int
+		redacted bool
+	}{
+		{"fewer than available", 2, 5, 2, false},
+		{"exactly available", 3, 3, 3, false},
+		{"more than available", 5, 2, 2, false},
+		{"redacted", 1, 3, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entries []*entry
+			for i := 0; i < tt.entries; i++ {
+				entries = append(entries, &entry{Name: "e", LoginPassword: "hunter2", Fields: fieldList{{"pin", "1234"}}})
+			}
+			stops := 0
+			var sampled bool
+			got := collect(sampleEntries(entryChan(entries...), tt.n, tt.redacted, func() { stops++ }, &sampled))
+			if len(got) != tt.want {
+				t.Errorf("got %d entries, want %d", len(got), tt.want)
+			}
+			// decryption is only stopped once the sample is complete
+			wantStops := 0
+			if tt.n <= tt.entries {
+				wantStops = 1
+			}
+			if sampled != (wantStops == 1) || stops != wantStops {
+				t.Errorf("got sampled %v and %d stops, want %d stops", sampled, stops, wantStops)
+			}
+			for _, e := range got {
+				if redacted := e.LoginPassword != "hunter2" && e.Fields[0].value != "1234"; redacted != tt.redacted {
+					t.Errorf("got password %q and field %q, want redacted: %v", e.LoginPassword, e.Fields[0].value, tt.redacted)
+				}
+			}
+		})
+	}
+}
+
+func TestSample(t *testing.T) {
+	fakeGPG(t, catGPG)
+	store := writeStore(t, map[string]string{"a": "pw\n", "b": "pw\n", "c": "pw\n", "d": "pw\n"})
+	file := filepath.Join(t.TempDir(), "out")
+	var err error
+	out := capture(t, &os.Stdout, func() {
+		err = runArgs("--no-unlock", "--password-store", store, "-o", file, "--sample", "2", "--sort", "name", "--redact")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := csvRows(t, out)
+	if len(rows) != 2 || rows[0]["name"] != "a" || rows[1]["name"] != "b" {
+		t.Fatalf("got %v, want a and b", rows)
+	}
+	if strings.Contains(out, ",pw,") {
+		t.Errorf("got %q, want the passwords redacted", out)
+	}
+	if data, _ := os.ReadFile(file); len(data) != 0 {
+		t.Errorf("got %q written to -o, want the sample on stdout only", data)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// compareEntries orders entries by folder and then by name, ignoring case.
+// Entries that only differ in case are ordered by their exact folder and
+// name, so the order is total and stable between runs. It returns a negative
+// number if a sorts before b, a positive one if after and 0 if both have the
+// same folder and name.
+func compareEntries(a, b *entry) int {
+	if c := strings.Compare(strings.ToLower(a.Folder), strings.ToLower(b.Folder)); c != 0 {
+		return c
+	}
+	if c := strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Folder, b.Folder); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Name, b.Name)
+}
+
+// sortEntries collects all entries and passes them on ordered by
+// compareEntries.
+func sortEntries(entries <-chan *entry) <-chan *entry {
+	c := make(chan *entry)
+	go func() {
+		defer close(c)
+		var all []*entry
+		for e := range entries {
+			all = append(all, e)
+		}
+		sort.SliceStable(all, func(i, j int) bool {
+			return compareEntries(all[i], all[j]) < 0
+		})
+		for _, e := range all {
+			c <- e
+		}
+	}()
+	return c
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// sortSet holds entries that only differ in case or by folder.
+var sortSet = []*entry{
+	{Folder: "web", Name: "github"},
+	{Folder: "web", Name: "GitHub"},
+	{Folder: "Web", Name: "github"},
+	{Folder: "web", Name: "amazon"},
+	{Folder: "mail", Name: "posteo"},
+	{Folder: "/", Name: "alpha"},
+	{Folder: "web/shop", Name: "amazon"},
+}
+
+func TestCompareEntriesTotalOrder(t *testing.T) {
+	for _, a := range sortSet {
+		for _, b := range sortSet {
+			ab, ba := compareEntries(a, b), compareEntries(b, a)
+			if (ab < 0) != (ba > 0) || (ab == 0) != (ba == 0) {
+				t.Errorf("%s/%s and %s/%s: compare gives %d and %d", a.Folder, a.Name, b.Folder, b.Name, ab, ba)
+			}
+			if ab == 0 && (a.Folder != b.Folder || a.Name != b.Name) {
+				t.Errorf("%s/%s and %s/%s compare equal", a.Folder, a.Name, b.Folder, b.Name)
+			}
+			for _, c := range sortSet {
+				if ab < 0 && compareEntries(b, c) < 0 && compareEntries(a, c) >= 0 {
+					t.Errorf("%s/%s < %s/%s < %s/%s is not transitive", a.Folder, a.Name, b.Folder, b.Name, c.Folder, c.Name)
+				}
+			}
+		}
+	}
+}
+
+func TestSortName(t *testing.T) {
+	files := map[string]string{}
+	for _, e := range sortSet {
+		path := e.Name
+		if e.Folder != "/" {
+			path = e.Folder + "/" + e.Name
+		}
+		files[path] = "pw\n"
+	}
+	want := append([]*entry(nil), sortSet...)
+	sort.Slice(want, func(i, j int) bool { return compareEntries(want[i], want[j]) < 0 })
+	var wantNames []string
+	for _, e := range want {
+		wantNames = append(wantNames, e.Folder+"|"+e.Name)
+	}
+
+	out, err := exportStore(t, files, "--sort", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range csvRows(t, out) {
+		folder := row["folder"]
+		if folder == "" {
+			folder = "/"
+		}
+		got = append(got, folder+"|"+row["name"])
+	}
+	if !reflect.DeepEqual(got, wantNames) {
+		t.Errorf("got %q, want %q", got, wantNames)
+	}
+}
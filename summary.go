@@ -0,0 +1,156 @@
+package main
+
+import "sync"
+
+// summary collects what happened to the entries of an export.
+type summary struct {
+	mu         sync.Mutex
+	skipped    int
+	collisions int
+	empty      int
+	noTOTP     int
+	minimal    int
+	noMatch    int
+	unmodified int
+	failures   []failure
+	// exported counts the written entries by type, see countExported,
+	// or the uploaded ones.
+	exported map[string]int
+}
+
+// failure is a password left out of the export and why.
+type failure struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// skip reports that fname is left out of the export.
+func (s *summary) skip(fname, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.skipped++
+	s.failures = append(s.failures, failure{fname, reason})
+	warnf("Skipping %s: %s\n", fname, reason)
+}
+
+func (s *summary) skippedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.skipped
+}
+
+// collision reports that fname is named like a folder and how that was
+// resolved.
+func (s *summary) collision(fname, resolution string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collisions++
+	warnf("Password %s is named like a folder, %s\n", fname, resolution)
+}
+
+func (s *summary) collisionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.collisions
+}
+
+// skipEmpty reports that fname produced neither a password nor any fields
+// or notes and is left out of the export.
+func (s *summary) skipEmpty(fname string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.empty++
+	warnf("Skipping %s: no password, fields or notes found\n", fname)
+}
+
+func (s *summary) emptyCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.empty
+}
+
+// dropNoTOTP reports that a password is left out by --only-with-totp.
+func (s *summary) dropNoTOTP() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noTOTP++
+}
+
+func (s *summary) noTOTPCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.noTOTP
+}
+
+// dropMinimal reports that a password is left out by --minimal because
+// nothing but notes or fields was found in it.
+func (s *summary) dropMinimal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minimal++
+}
+
+func (s *summary) minimalCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.minimal
+}
+
+// dropNoMatch reports that a password is left out by --content-match.
+func (s *summary) dropNoMatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noMatch++
+}
+
+func (s *summary) noMatchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.noMatch
+}
+
+// dropUnmodified reports that a password is left out by --modified-after.
+func (s *summary) dropUnmodified() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unmodified++
+}
+
+func (s *summary) unmodifiedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unmodified
+}
+
+// countExported passes entries through while counting them by type.
+func (s *summary) countExported(entries <-chan *entry) <-chan *entry {
+	c := make(chan *entry)
+	go func() {
+		defer close(c)
+		for e := range entries {
+			s.export(e)
+			c <- e
+		}
+	}()
+	return c
+}
+
+// export counts e as exported.
+func (s *summary) export(e *entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.exported == nil {
+		s.exported = map[string]int{}
+	}
+	s.exported[e.Type]++
+}
+
+func (s *summary) exportedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, count := range s.exported {
+		n += count
+	}
+	return n
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// teeEntries passes entries on unchanged and appends every one to seen. seen
+// is complete once the returned channel is closed.
+func teeEntries(entries <-chan *entry, seen *[]*entry) <-chan *entry {
+	c := make(chan *entry)
+	go func() {
+		defer close(c)
+		for e := range entries {
+			*seen = append(*seen, e)
+			c <- e
+		}
+	}()
+	return c
+}
+
+// writeTable prints an aligned overview of entries without any secrets.
+func writeTable(w io.Writer, entries []*entry) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FOLDER\tNAME\tTYPE\tTOTP")
+	for _, e := range entries {
+		totp := "no"
+		if e.LoginTOTP != "" {
+			totp = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Folder, e.Name, e.Type, totp)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteTable(t *testing.T) {
+	var out bytes.Buffer
+	err := writeTable(&out, []*entry{
+		{Folder: "/", Name: "bank", Type: "login", LoginPassword: "hunter2"},
+		{Folder: "web/shops", Name: "shop", Type: "login", LoginTOTP: "JBSWY3DPEHPK3PXP"},
+		{Folder: "notes", Name: "wifi", Type: "note", Notes: "ssid: home\n"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "FOLDER     NAME  TYPE   TOTP\n" +
+		"/          bank  login  no\n" +
+		"web/shops  shop  login  yes\n" +
+		"notes      wifi  note   no\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+	if bytes.Contains(out.Bytes(), []byte("hunter2")) || bytes.Contains(out.Bytes(), []byte("JBSWY3DP")) {
+		t.Error("table shows a secret")
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TOTP representations selected with --totp-format.
+const (
+	totpAuto = "auto" // whatever the output format prefers
+	totpKeep = "keep" // as found in the password file
+	totpBare = "bare" // only the base32 secret
+	totpURI  = "uri"  // an otpauth:// URI
+)
+
+// minSecretLen is the shortest bare secret accepted, 80 bits in base32.
+// Shorter values, such as sms or yes, are words and not secrets.
+const minSecretLen = 16
+
+// bareSecret returns s as an uppercase base32 secret without spaces, or
+// false when s does not decode as base32 or is shorter than minSecretLen.
+func bareSecret(s string) (string, bool) {
+	secret := strings.ToUpper(strings.Join(strings.Fields(s), ""))
+	unpadded := strings.TrimRight(secret, "=")
+	// no number of bytes encodes to 1, 3 or 6 trailing characters
+	if n := len(unpadded) % 8; len(unpadded) < minSecretLen || n == 1 || n == 3 || n == 6 {
+		return "", false
+	}
+	if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(unpadded); err != nil {
+		return "", false
+	}
+	return secret, true
+}
+
+// convertTOTP returns totp in the given representation. name labels the
+// secret in a generated otpauth URI.
+func convertTOTP(fname, name, totp, format string) string {
+	if totp == "" {
+		return ""
+	}
+	isURI := strings.HasPrefix(strings.ToLower(totp), "otpauth://")
+	switch {
+	case format == totpBare && isURI:
+		u, err := url.Parse(totp)
+		if err != nil {
+			warnf("Could not parse TOTP URI of password %s: %s\n", fname, err)
+			return totp
+		}
+		q := u.Query()
+		if (q.Get("digits") != "" && q.Get("digits") != "6") ||
+			(q.Get("period") != "" && q.Get("period") != "30") ||
+			(q.Get("algorithm") != "" && !strings.EqualFold(q.Get("algorithm"), "SHA1")) {
+			warnf("TOTP of password %s uses non-default parameters that a bare secret cannot carry\n", fname)
+		}
+		return q.Get("secret")
+	case format == totpURI && !isURI:
+		secret := strings.ToUpper(strings.ReplaceAll(totp, " ", ""))
+		return fmt.Sprintf("otpauth://totp/%s?secret=%s", url.PathEscape(name), secret)
+	}
+	return totp
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBareSecret(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   string
+		wantOK bool
+	}{
+		{"JBSWY3DPEHPK3PXP", "JBSWY3DPEHPK3PXP", true},
+		{"jbsw y3dp ehpk 3pxp", "JBSWY3DPEHPK3PXP", true},
+		{"GEZDGNBVGY3TQOJQGEZDGNBVGY======", "GEZDGNBVGY3TQOJQGEZDGNBVGY======", true},
+		{"sms", "", false},
+		{"app", "", false},
+		{"none", "", false},
+		{"yes", "", false},
+		{"JBSWY3DP", "", false},
+		{"JBSWY3DPEHPK3PX1", "", false},
+		{"JBSWY3DPEHPK3PXPA", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := bareSecret(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestBareSecretField(t *testing.T) {
+	tests := []struct {
+		name, content string
+		wantTOTP      string
+		wantFields    int
+	}{
+		{"bare secret", "pw\notp: JBSWY3DPEHPK3PXP\n", "JBSWY3DPEHPK3PXP", 0},
+		{"uri", "pw\notpauth: otpauth://totp/a?secret=JBSWY3DPEHPK3PXP\n", "otpauth://totp/a?secret=JBSWY3DPEHPK3PXP", 0},
+		{"word", "pw\notp: sms\n", "", 1},
+		{"invalid", "pw\notp: not-a-secret-at-all\n", "", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := processEntry(t, parseArgv(t, "--totp-format", "keep"), "/site.gpg", tt.content)
+			if e.LoginTOTP != tt.wantTOTP || len(e.Fields) != tt.wantFields {
+				t.Errorf("got totp %q and fields %v, want %q and %d fields", e.LoginTOTP, e.Fields, tt.wantTOTP, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestConvertTOTPPerFormat(t *testing.T) {
+	const (
+		bare = "JBSWY3DPEHPK3PXP"
+		uri  = "otpauth://totp/site?secret=JBSWY3DPEHPK3PXP"
+	)
+	tests := []struct {
+		format   string
+		args     []string
+		fromBare string
+		fromURI  string
+	}{
+		{"bitwarden", nil, bare, uri},
+		{"nordpass", nil, bare, uri},
+		{"dashlane", nil, bare, bare},
+		{"enpass", nil, bare, uri},
+		{"roboform", nil, bare, uri},
+		{"totp-migration", nil, uri, uri},
+		{"raw", nil, bare, uri},
+		{"kdbx", nil, uri, uri},
+		{"dashlane", []string{"--totp-format", "keep"}, bare, uri},
+		{"bitwarden", []string{"--totp-format", "bare"}, bare, bare},
+		{"bitwarden", []string{"--totp-format", "uri"}, uri, uri},
+		{"kdbx", []string{"--totp-format", "auto"}, uri, uri},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(append([]string{tt.format}, tt.args...), " "), func(t *testing.T) {
+			argv := parseArgv(t, append([]string{"--format", tt.format}, tt.args...)...)
+			for _, c := range []struct{ in, want string }{{bare, tt.fromBare}, {uri, tt.fromURI}} {
+				e := processEntry(t, argv, "/site.gpg", "pw\ntotp: "+c.in+"\n")
+				if e.LoginTOTP != c.want {
+					t.Errorf("%s: got %q, want %q", c.in, e.LoginTOTP, c.want)
+				}
+			}
+		})
+	}
+}
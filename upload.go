@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// uploadInterval is the minimum time between two calls to the server, so
+// large stores do not run into its rate limit.
+const uploadInterval = 100 * time.Millisecond
+
+type bwFolder struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type bwURI struct {
+	URI   string `json:"uri"`
+	Match *int   `json:"match"`
+}
+
+// uriMatches are the URI match detections of Bitwarden, selected with
+// --uri-match.
+var uriMatches = map[string]int{
+	"domain":      0,
+	"host":        1,
+	"starts-with": 2,
+	"exact":       3,
+	"regexp":      4,
+	"never":       5,
+}
+
+type bwLogin struct {
+	Username string  `json:"username,omitempty"`
+	Password string  `json:"password,omitempty"`
+	TOTP     string  `json:"totp,omitempty"`
+	URIs     []bwURI `json:"uris,omitempty"`
+}
+
+type bwField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Type  int    `json:"type"`
+}
+
+type bwItem struct {
+	Type       int            `json:"type"`
+	Name       string         `json:"name"`
+	Notes      string         `json:"notes,omitempty"`
+	Favorite   bool           `json:"favorite"`
+	FolderID   *string        `json:"folderId"`
+	Login      *bwLogin       `json:"login,omitempty"`
+	SecureNote map[string]int `json:"secureNote,omitempty"`
+	Fields     []bwField      `json:"fields,omitempty"`
+}
+
+// bwClient creates items with the Bitwarden CLI, which talks to the
+// server of the account it is logged in to, Vaultwarden included.
+type bwClient struct {
+	// run calls bw with args and stdin as its input, which may be nil, and
+	// returns its output.
+	run     func(stdin []byte, args ...string) ([]byte, error)
+	folders map[string]string
+	last    time.Time
+}
+
+func newBWClient() (*bwClient, error) {
+	if _, err := exec.LookPath("bw"); err != nil {
+		return nil, fmt.Errorf("--upload needs the Bitwarden CLI bw: %w", err)
+	}
+	if os.Getenv("BW_SESSION") == "" {
+		return nil, errors.New("--upload needs an unlocked vault, set BW_SESSION to the output of bw unlock --raw")
+	}
+	return &bwClient{run: runBW}, nil
+}
+
+func runBW(stdin []byte, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("bw", args...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// call runs bw, waiting for uploadInterval since the previous call.
+func (c *bwClient) call(stdin []byte, args ...string) ([]byte, error) {
+	if wait := uploadInterval - time.Since(c.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	defer func() { c.last = time.Now() }()
+	return c.run(stdin, args...)
+}
+
+// create creates an object of kind from v, encoded the way bw create
+// expects it. The encoded object is passed on stdin, so the secrets of
+// an item never show up in the process list.
+func (c *bwClient) create(kind string, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.call([]byte(base64.StdEncoding.EncodeToString(data)), "create", kind)
+}
+
+// folderID returns the id of the folder named name, creating it when the
+// vault does not have it yet.
+func (c *bwClient) folderID(name string) (string, error) {
+	if c.folders == nil {
+		out, err := c.call(nil, "list", "folders")
+		if err != nil {
+			return "", fmt.Errorf("could not list folders: %w", err)
+		}
+		var folders []bwFolder
+		if err := json.Unmarshal(out, &folders); err != nil {
+			return "", fmt.Errorf("could not read folders: %w", err)
+		}
+		c.folders = map[string]string{}
+		for _, f := range folders {
+			c.folders[f.Name] = f.ID
+		}
+	}
+	if id, ok := c.folders[name]; ok {
+		return id, nil
+	}
+	out, err := c.create("folder", bwFolder{Name: name})
+	if err != nil {
+		return "", fmt.Errorf("could not create folder %s: %w", name, err)
+	}
+	var folder bwFolder
+	if err := json.Unmarshal(out, &folder); err != nil {
+		return "", fmt.Errorf("could not read folder %s: %w", name, err)
+	}
+	c.folders[name] = folder.ID
+	return folder.ID, nil
+}
+
+// bwItemFor maps e to a Bitwarden item, a secure note for note entries and a
+// login otherwise. match is the URI match detection, nil for the default
+// of the vault.
+func bwItemFor(e *entry, match *int) bwItem {
+	item := bwItem{Name: e.Name, Notes: e.Notes, Favorite: e.Favorite != 0}
+	if e.Type == "note" {
+		item.Type = 2
+		item.SecureNote = map[string]int{"type": 0}
+	} else {
+		item.Type = 1
+		item.Login = &bwLogin{Username: e.LoginUsername, Password: e.LoginPassword, TOTP: e.LoginTOTP}
+		if e.LoginURI != "" {
+			for _, uri := range strings.Split(e.LoginURI, ",") {
+				item.Login.URIs = append(item.Login.URIs, bwURI{URI: uri, Match: match})
+			}
+		}
+	}
+	for _, fl := range e.Fields {
+		item.Fields = append(item.Fields, bwField{Name: fl.key, Value: fl.value})
+	}
+	// type 1 is a hidden field
+	for _, fl := range e.hidden {
+		item.Fields = append(item.Fields, bwField{Name: fl.key, Value: fl.value, Type: 1})
+	}
+	return item
+}
+
+// uploadEntries creates an item for every entry and counts it as exported
+// in sum. Entries that cannot be created are skipped and reported through
+// sum.
+func uploadEntries(c *bwClient, sum *summary, match *int, entries <-chan *entry) {
+	for e := range entries {
+		item := bwItemFor(e, match)
+		if folder := folderName(e); folder != "" {
+			id, err := c.folderID(folder)
+			if err != nil {
+				sum.skip(e.fname, err.Error())
+				continue
+			}
+			item.FolderID = &id
+		}
+		if _, err := c.create("item", item); err != nil {
+			sum.skip(e.fname, fmt.Sprintf("could not upload: %s", err))
+			continue
+		}
+		sum.export(e)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bwCall is a call of the bw command.
+type bwCall struct {
+	args  string
+	stdin string
+}
+
+// fakeBW records the calls of c and answers them from replies, keyed by
+// the arguments.
+func fakeBW(c *bwClient, calls *[]bwCall, replies map[string]string) {
+	c.run = func(stdin []byte, args ...string) ([]byte, error) {
+		call := bwCall{args: strings.Join(args, " ")}
+		if stdin != nil {
+			decoded, err := base64.StdEncoding.DecodeString(string(stdin))
+			if err != nil {
+				return nil, err
+			}
+			call.stdin = string(decoded)
+		}
+		*calls = append(*calls, call)
+		reply, ok := replies[call.args]
+		if !ok {
+			return nil, errors.New("unexpected call")
+		}
+		return []byte(reply), nil
+	}
+}
+
+func TestUploadEntries(t *testing.T) {
+	var calls []bwCall
+	c := &bwClient{}
+	fakeBW(c, &calls, map[string]string{
+		"list folders":  `[{"id": "1", "name": "mail"}]`,
+		"create folder": `{"id": "2", "name": "web"}`,
+		"create item":   `{}`,
+	})
+	match := uriMatches["host"]
+	sum := &summary{}
+	uploadEntries(c, sum, &match, entryChan(
+		&entry{Folder: "web", Name: "site", LoginURI: "https://a.example", LoginUsername: "alice", LoginPassword: "hunter2",
+			Fields: fieldList{{"customer_id", "4711"}}, hidden: fieldList{{"pin", "1234"}}},
+		&entry{Folder: "/", Name: "wifi", Type: "note", Notes: "ssid: home\n"},
+	))
+
+	want := []bwCall{
+		{"list folders", ""},
+		{"create folder", `{"name":"web"}`},
+		{"create item", `{"type":1,"name":"site","favorite":false,"folderId":"2","login":{"username":"alice","password":"hunter2",` +
+			`"uris":[{"uri":"https://a.example","match":1}]},"fields":[{"name":"customer_id","value":"4711","type":0},{"name":"pin","value":"1234","type":1}]}`},
+		{"create item", `{"type":2,"name":"wifi","notes":"ssid: home\n","favorite":false,"folderId":null,"secureNote":{"type":0}}`},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls\n%q\nwant\n%q", calls, want)
+	}
+	if n := sum.exportedCount(); n != 2 {
+		t.Errorf("got %d exported, want 2", n)
+	}
+	for _, call := range calls {
+		if strings.Contains(call.args, "hunter2") {
+			t.Errorf("secret passed as an argument: %s", call.args)
+		}
+		if call.stdin != "" && !json.Valid([]byte(call.stdin)) {
+			t.Errorf("invalid JSON on stdin: %s", call.stdin)
+		}
+	}
+}
+
+func TestUploadEntriesSkipsFailures(t *testing.T) {
+	var calls []bwCall
+	c := &bwClient{folders: map[string]string{}}
+	// no reply for create item, so every upload fails
+	fakeBW(c, &calls, map[string]string{})
+	sum := &summary{}
+	uploadEntries(c, sum, nil, entryChan(
+		&entry{Folder: "/", Name: "a", fname: "/a.gpg"},
+		&entry{Folder: "web", Name: "b", fname: "/web/b.gpg"},
+	))
+	if len(calls) != 2 || sum.skippedCount() != 2 || sum.exportedCount() != 0 {
+		t.Errorf("got %d calls, %d skipped and %d exported, want 2, 2 and 0", len(calls), sum.skippedCount(), sum.exportedCount())
+	}
+	var names []string
+	for _, f := range sum.failures {
+		names = append(names, f.Name)
+	}
+	if want := []string{"/a.gpg", "/web/b.gpg"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got failures for %q, want %q", names, want)
+	}
+}
+
+func TestURIMatch(t *testing.T) {
+	e := &entry{Name: "site", LoginURI: "https://a.example,https://b.example/login"}
+	tests := []struct {
+		match string
+		want  string
+	}{
+		{"", "null"},
+		{"domain", "0"},
+		{"host", "1"},
+		{"starts-with", "2"},
+		{"exact", "3"},
+		{"regexp", "4"},
+		{"never", "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.match, func(t *testing.T) {
+			var match *int
+			if m, ok := uriMatches[tt.match]; ok {
+				match = &m
+			}
+			data, err := json.Marshal(bwItemFor(e, match).Login.URIs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := `[{"uri":"https://a.example","match":` + tt.want + `},{"uri":"https://b.example/login","match":` + tt.want + `}]`
+			if string(data) != want {
+				t.Errorf("got %s, want %s", data, want)
+			}
+		})
+	}
+}
+
+func TestURIMatchValidated(t *testing.T) {
+	if err := runArgs("--no-unlock", "--password-store", t.TempDir(), "--uri-match", "fuzzy"); !errors.Is(err, errUsage) {
+		t.Errorf("got %v, want %v", err, errUsage)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// walkParallel walks the tree at root like filepath.Walk, but reads up to
+// workers directories at the same time, which hides the latency of network
+// file systems. fn is called from several goroutines at once. The entries
+// of a directory are visited in lexical order, the directories themselves
+// in no particular order. The walk stops at the first error fn returns.
+func walkParallel(root string, workers int, fn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	if err := fn(root, info, nil); err != nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	var (
+		wg    sync.WaitGroup
+		sem   = make(chan struct{}, workers)
+		mu    sync.Mutex
+		first error
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return first != nil
+	}
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if first == nil {
+			first = err
+		}
+	}
+
+	var visit func(dir string, info os.FileInfo)
+	visit = func(dir string, info os.FileInfo) {
+		defer wg.Done()
+		// only the directory read is bounded, so a directory waiting for
+		// its subdirectories never holds a slot
+		sem <- struct{}{}
+		entries, err := os.ReadDir(dir)
+		<-sem
+		if err != nil {
+			if err := fn(dir, info, err); err != nil && err != filepath.SkipDir {
+				fail(err)
+			}
+			return
+		}
+		for _, d := range entries {
+			if failed() {
+				return
+			}
+			path := filepath.Join(dir, d.Name())
+			info, err := d.Info()
+			if err == nil {
+				err = fn(path, info, nil)
+			} else {
+				err = fn(path, nil, err)
+			}
+			if err == filepath.SkipDir {
+				if info != nil && info.IsDir() {
+					continue
+				}
+				// like filepath.Walk, SkipDir on a file skips the rest of
+				// its directory
+				return
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+			if info != nil && info.IsDir() {
+				wg.Add(1)
+				go visit(path, info)
+			}
+		}
+	}
+	wg.Add(1)
+	visit(root, info)
+	wg.Wait()
+	return first
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// deepTree creates a store of depth levels of fanout folders, each holding
+// files password files, and returns its directory.
+func deepTree(tb testing.TB, depth, fanout, files int) string {
+	tb.Helper()
+	root := tb.TempDir()
+	var fill func(dir string, level int)
+	fill = func(dir string, level int) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			tb.Fatal(err)
+		}
+		for i := 0; i < files; i++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("p%d.gpg", i)), nil, 0600); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		if level < depth {
+			for i := 0; i < fanout; i++ {
+				fill(filepath.Join(dir, fmt.Sprintf("d%d", i)), level+1)
+			}
+		}
+	}
+	fill(root, 0)
+	return root
+}
+
+// walkedFiles counts how often walkFiles sends every path below root.
+func walkedFiles(t *testing.T, root string, workers int) map[string]int {
+	t.Helper()
+	paths, errc := walkFiles(make(chan struct{}), &summary{}, root, false, time.Time{}, workers)
+	seen := map[string]int{}
+	for path := range paths {
+		seen[path]++
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	return seen
+}
+
+func TestWalkParallel(t *testing.T) {
+	root := deepTree(t, 3, 3, 4)
+	if err := os.MkdirAll(filepath.Join(root, "d0", ".git"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "d0", ".git", "x.gpg"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := walkedFiles(t, root, 0)
+	// 1 + 3 + 9 + 27 folders with 4 files each
+	if len(want) != 160 {
+		t.Fatalf("sequential walk found %d files, want 160", len(want))
+	}
+	for _, workers := range []int{2, 4, 16} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			got := walkedFiles(t, root, workers)
+			for path, n := range got {
+				if n != 1 {
+					t.Errorf("%s visited %d times", path, n)
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %d files, want the %d of the sequential walk", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestWalkParallelStops(t *testing.T) {
+	root := deepTree(t, 3, 3, 4)
+	stop := errors.New("stop")
+	var mu sync.Mutex
+	calls := 0
+	err := walkParallel(root, 4, func(path string, info os.FileInfo, err error) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if calls++; calls == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("got %v, want %v", err, stop)
+	}
+}
+
+func TestWalkParallelSkipDir(t *testing.T) {
+	root := deepTree(t, 2, 2, 1)
+	var mu sync.Mutex
+	var files []string
+	err := walkParallel(root, 4, func(path string, info os.FileInfo, err error) error {
+		if info.IsDir() && info.Name() == "d1" {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() {
+			mu.Lock()
+			files = append(files, path)
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every d1 is skipped, the root, d0 and d0/d0 hold a file each
+	if len(files) != 3 {
+		t.Errorf("got %d files, want 3: %v", len(files), files)
+	}
+}
+
+func BenchmarkWalkFiles(b *testing.B) {
+	root := deepTree(b, 4, 5, 4)
+	for _, workers := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				paths, errc := walkFiles(make(chan struct{}), &summary{}, root, false, time.Time{}, workers)
+				for range paths {
+				}
+				if err := <-errc; err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watch exports the store to the -o file and exports it again every time a
+// password changes, until the process is stopped.
+func watch(argv *argT) error {
+	stdout, err := isStdout(argv.Output)
+	if err != nil {
+		return err
+	}
+	if stdout {
+		return fmt.Errorf("%w: --watch requires an output file, set it with -o", errUsage)
+	}
+	name := argv.Output.Name()
+	argv.Output.Close()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	for _, store := range argv.PasswordStores {
+		if err := watchDirs(watcher, store, argv.StrictWalk); err != nil {
+			return err
+		}
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		for event := range watcher.Events {
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					watchDirs(watcher, event.Name, argv.StrictWalk)
+				}
+			}
+			if !strings.HasSuffix(event.Name, ".gpg") {
+				continue
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+		close(changes)
+	}()
+	go func() {
+		for err := range watcher.Errors {
+			errorf("Error while watching the password store: %s\n", err)
+		}
+	}()
+
+	exportFile(argv, name)
+	for range debounce(changes, argv.WatchDebounce.Duration) {
+		exportFile(argv, name)
+	}
+	return nil
+}
+
+// watchDirs adds root and every directory below it to watcher, as fsnotify
+// does not watch recursively. Unreadable folders are left out unless strict
+// is set.
+func watchDirs(watcher *fsnotify.Watcher, root string, strict bool) error {
+	return walkStore(root, skipUnreadable(root, strict, nil, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		return watcher.Add(path)
+	}))
+}
+
+// exportFile writes a complete export next to name and moves it in place,
+// so readers never see a half written export. An export that skipped some
+// entries is still moved in place.
+func exportFile(argv *argT, name string) {
+	tmp := name + ".tmp"
+	var skipped error
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err == nil {
+		err = export(argv, f, nil)
+		if errors.Is(err, errPartial) {
+			skipped, err = err, nil
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		errorf("Export to %s failed: %s\n", name, err)
+		return
+	}
+	if skipped != nil {
+		warnf("Exported to %s at %s, %s\n", name, time.Now().Format("15:04:05"), skipped)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Exported to %s at %s\n", name, time.Now().Format("15:04:05"))
+}
+
+// debounce forwards a signal once no further signal arrived on in for d. The
+// returned channel is closed when in is closed.
+func debounce(in <-chan struct{}, d time.Duration) <-chan struct{} {
+	out := make(chan struct{})
+	go func() {
+		defer close(out)
+		for {
+			if _, ok := <-in; !ok {
+				return
+			}
+			timer := time.NewTimer(d)
+		quiet:
+			for {
+				select {
+				case _, ok := <-in:
+					if !ok {
+						timer.Stop()
+						return
+					}
+					timer.Reset(d)
+				case <-timer.C:
+					break quiet
+				}
+			}
+			out <- struct{}{}
+		}
+	}()
+	return out
+}
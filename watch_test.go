@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebounce(t *testing.T) {
+	in := make(chan struct{})
+	out := debounce(in, 50*time.Millisecond)
+
+	// a burst of changes closer together than the interval
+	for i := 0; i < 5; i++ {
+		in <- struct{}{}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Fatal("no signal after the burst")
+	}
+	select {
+	case <-out:
+		t.Fatal("more than one signal for a single burst")
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	in <- struct{}{}
+	select {
+	case <-out:
+	case <-time.After(time.Second):
+		t.Fatal("no signal after the second change")
+	}
+
+	close(in)
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("signal after closing the input")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("output not closed after the input")
+	}
+}
+
+func TestDebounceClosedWhilePending(t *testing.T) {
+	in := make(chan struct{})
+	out := debounce(in, time.Hour)
+	in <- struct{}{}
+	close(in)
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Fatal("pending signal sent after closing the input")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("output not closed after the input")
+	}
+}
+
+func TestExportFileWithSkippedEntries(t *testing.T) {
+	fakeGPG(t, catGPG)
+	store := writeStore(t, map[string]string{"ok": "pw\n", "bin": "\xff\xfe\n"})
+	name := filepath.Join(t.TempDir(), "out.csv")
+	stderr := capture(t, &os.Stderr, func() {
+		exportFile(parseArgv(t, "--no-unlock", "--password-store", store), name)
+	})
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("got no export: %v", err)
+	}
+	if rows := csvRows(t, string(data)); len(rows) != 1 || rows[0]["name"] != "ok" {
+		t.Errorf("got rows %v, want only ok", rows)
+	}
+	if _, err := os.Stat(name + ".tmp"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v for the temporary file, want it moved", err)
+	}
+	if !strings.Contains(stderr, "some entries were skipped (1)") {
+		t.Errorf("got stderr %q, want the skipped count", stderr)
+	}
+}